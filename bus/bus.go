@@ -0,0 +1,143 @@
+package bus
+
+import (
+	"sync"
+
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// OverflowPolicy tells what happens when a Notification is published to a subscriber with a full buffer.
+type OverflowPolicy int
+
+const (
+	// DropNewest drops the Notification being published, the buffered ones are kept.
+	DropNewest OverflowPolicy = iota
+	// DropOldest drops the oldest buffered Notification to make room for the one being published.
+	DropOldest
+)
+
+func (op OverflowPolicy) String() string {
+	switch op {
+	case DropNewest:
+		return "drop newest"
+	case DropOldest:
+		return "drop oldest"
+	default:
+		return "unknown"
+	}
+}
+
+type subscription struct {
+	name    string
+	ch      chan model.Notification
+	policy  OverflowPolicy
+	filter  func(model.Notification) bool
+	dropped int
+}
+
+// Bus is a publish/subscribe bus of Notifications. Publishing never blocks, every subscriber has its own buffer
+// and an OverflowPolicy deciding which Notification gets dropped when the subscriber cannot keep up.
+type Bus struct {
+	subscriptions map[int]*subscription
+	nextID        int
+	mu            sync.Mutex
+}
+
+// New creates a new Bus without subscribers.
+func New() *Bus {
+	return &Bus{
+		subscriptions: make(map[int]*subscription),
+	}
+}
+
+// Subscribe registers a new subscriber with the given name (used in the logs), buffer size and OverflowPolicy.
+// The returned function unsubscribes and closes the channel.
+func (b *Bus) Subscribe(name string, buffer int, policy OverflowPolicy) (<-chan model.Notification, func()) {
+	return b.SubscribeFiltered(name, buffer, policy, nil)
+}
+
+// SubscribeFiltered is like Subscribe, but only the Notifications accepted by the filter are delivered to the subscriber,
+// the rest never take up room in its buffer and are not counted as dropped. A nil filter accepts every Notification.
+func (b *Bus) SubscribeFiltered(name string, buffer int, policy OverflowPolicy, filter func(model.Notification) bool) (<-chan model.Notification, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	sub := &subscription{
+		name:   name,
+		ch:     make(chan model.Notification, buffer),
+		policy: policy,
+		filter: filter,
+	}
+	b.subscriptions[id] = sub
+
+	log.Debug("%s subscribed to the Bus (buffer: %d, overflow policy: %s)", name, buffer, policy)
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscriptions[id]; ok {
+			delete(b.subscriptions, id)
+			close(sub.ch)
+			log.Debug("%s unsubscribed from the Bus", name)
+		}
+	}
+
+	return sub.ch, unsubscribe
+}
+
+// Publish delivers the Notification to every subscriber without blocking.
+func (b *Bus) Publish(notification model.Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subscriptions {
+		sub.deliver(notification)
+	}
+}
+
+// deliver puts the Notification into the buffer of the subscriber, applying its OverflowPolicy if the buffer is full.
+// It must be called while holding the mutex of the Bus, so there is only one sender at a time.
+func (sub *subscription) deliver(notification model.Notification) {
+	if sub.filter != nil && !sub.filter(notification) {
+		return
+	}
+
+	select {
+	case sub.ch <- notification:
+		return
+	default:
+	}
+
+	sub.dropped++
+
+	if sub.policy == DropOldest {
+		select {
+		case dropped := <-sub.ch:
+			log.Warn("%s cannot keep up, Notification dropped: %s", sub.name, dropped.Kind)
+		default:
+		}
+		select {
+		case sub.ch <- notification:
+		default:
+			// the buffer has no capacity at all
+		}
+		return
+	}
+
+	log.Warn("%s cannot keep up, Notification dropped: %s", sub.name, notification.Kind)
+}
+
+// Dropped returns the number of dropped Notifications for every subscriber by name.
+func (b *Bus) Dropped() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dropped := map[string]int{}
+	for _, sub := range b.subscriptions {
+		dropped[sub.name] += sub.dropped
+	}
+	return dropped
+}
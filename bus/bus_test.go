@@ -0,0 +1,73 @@
+package bus_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/bus"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+func drain(ch <-chan model.Notification) (kinds []string) {
+	for {
+		select {
+		case notification := <-ch:
+			kinds = append(kinds, notification.Kind)
+		default:
+			return
+		}
+	}
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	require := assert.New(t)
+
+	b := bus.New()
+	newest, unsubscribeNewest := b.Subscribe("newest", 2, bus.DropNewest)
+	defer unsubscribeNewest()
+	oldest, unsubscribeOldest := b.Subscribe("oldest", 2, bus.DropOldest)
+	defer unsubscribeOldest()
+
+	for _, kind := range []string{"a", "b", "c", "d"} {
+		b.Publish(model.Notification{Kind: kind})
+	}
+
+	require.Equal([]string{"a", "b"}, drain(newest))
+	require.Equal([]string{"c", "d"}, drain(oldest))
+	require.Equal(map[string]int{"newest": 2, "oldest": 2}, b.Dropped())
+}
+
+func TestSubscribeFiltered(t *testing.T) {
+	require := assert.New(t)
+
+	b := bus.New()
+	filtered, unsubscribe := b.SubscribeFiltered("filtered", 2, bus.DropOldest, func(notification model.Notification) bool {
+		return notification.Kind != model.NotificationTick
+	})
+	defer unsubscribe()
+
+	for _, kind := range []string{"a", model.NotificationTick, "b", model.NotificationTick, model.NotificationTick, "c"} {
+		b.Publish(model.Notification{Kind: kind})
+	}
+
+	require.Equal([]string{"b", "c"}, drain(filtered))
+	require.Equal(map[string]int{"filtered": 1}, b.Dropped())
+}
+
+func TestUnsubscribe(t *testing.T) {
+	require := assert.New(t)
+
+	b := bus.New()
+	ch, unsubscribe := b.Subscribe("subscriber", 1, bus.DropNewest)
+
+	unsubscribe()
+	// unsubscribing twice is harmless
+	unsubscribe()
+
+	b.Publish(model.Notification{Kind: "a"})
+
+	_, open := <-ch
+	require.False(open)
+	require.Empty(b.Dropped())
+}
@@ -2,36 +2,349 @@ package client
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// DefaultConnectTimeout is the time the Client waits for a connection to the Server
+	DefaultConnectTimeout = 3 * time.Second
+	// DefaultRetryBackoff is the wait before the first retry to connect, it is doubled before every further retry
+	DefaultRetryBackoff = 200 * time.Millisecond
 )
 
-// Client is a super simple TCP Socket client
+// Client is a super simple client of the Server, it dials the TCP Port or a Unix domain socket
 type Client struct {
-	port int
+	host   string
+	port   int
+	socket string
+	token  string
+	// lockFile is the lock file of the Server the port (or the socket) is discovered from, if neither is set
+	lockFile string
+	// connectTimeout and responseTimeout limit the dial and the wait for a response, 0 means no limit
+	connectTimeout  time.Duration
+	responseTimeout time.Duration
+	// retries is the number of further attempts to connect after a failed one, the first one after backoff
+	retries int
+	backoff time.Duration
 }
 
+// NewClient creates a Client of the Server on the TCP Port of this machine.
 func NewClient(port int) *Client {
 	return &Client{
-		port: port,
+		host:           "localhost",
+		port:           port,
+		connectTimeout: DefaultConnectTimeout,
+		backoff:        DefaultRetryBackoff,
+	}
+}
+
+// WithHost makes the Client dial the Server on another host.
+func (cli *Client) WithHost(host string) *Client {
+	cli.host = host
+	return cli
+}
+
+// WithTimeouts sets the time the Client waits for a connection and for a response, 0 means no limit.
+// The streams of Watch are only limited until the Server accepts them.
+func (cli *Client) WithTimeouts(connect time.Duration, response time.Duration) *Client {
+	cli.connectTimeout = connect
+	cli.responseTimeout = response
+	return cli
+}
+
+// WithRetries makes the Client retry to connect, waiting backoff before the first retry and twice as long before
+// every further one. Only the connection is retried, a request is never sent twice.
+func (cli *Client) WithRetries(retries int, backoff time.Duration) *Client {
+	cli.retries = retries
+	cli.backoff = backoff
+	return cli
+}
+
+// WithLockFile makes the Client discover the port (or the socket) of the Server from its lock file, if neither
+// of them is set. If there is no lock file, the Client dials the default port.
+func (cli *Client) WithLockFile(path string) *Client {
+	cli.lockFile = path
+	return cli
+}
+
+// target returns the network and the address the Client dials. The lock file is read on every dial,
+// so a Server started in the meantime is found too.
+func (cli *Client) target() (string, string) {
+	if cli.socket != "" {
+		return "unix", cli.socket
+	}
+
+	port := cli.port
+	if port == 0 && cli.lockFile != "" {
+		port = model.DefaultPort
+		// the Server writes its port once it listens, and 0 if it only listens on the socket
+		if lock, err := model.ReadServerLock(cli.lockFile); err == nil {
+			switch {
+			case lock.Port != 0:
+				port = lock.Port
+			case lock.Socket != "":
+				return "unix", lock.Socket
+			}
+		}
+	}
+	return "tcp", net.JoinHostPort(cli.host, strconv.Itoa(port))
+}
+
+// Address returns the address the Client dials.
+func (cli *Client) Address() string {
+	_, address := cli.target()
+	return address
+}
+
+// WithToken sets the shared secret sent with every request, required if the Server is run with a token.
+func (cli *Client) WithToken(token string) *Client {
+	cli.token = token
+	return cli
+}
+
+// WithSocket makes the Client dial the Unix domain socket at the given path instead of the TCP Port.
+func (cli *Client) WithSocket(path string) *Client {
+	cli.socket = path
+	return cli
+}
+
+// dial connects to the Server on the socket if it is set, otherwise on the TCP Port. If the Server cannot be
+// reached after the retries, a *ConnectError is returned.
+func (cli *Client) dial() (net.Conn, error) {
+	backoff := cli.backoff
+	for attempt := 0; ; attempt++ {
+		network, address := cli.target()
+		conn, err := net.DialTimeout(network, address, cli.connectTimeout)
+		if err == nil {
+			return conn, nil
+		}
+		if attempt >= cli.retries {
+			return nil, &ConnectError{Address: address, Err: err}
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// setResponseDeadline limits the wait for the response on the connection.
+func (cli *Client) setResponseDeadline(conn net.Conn) error {
+	if cli.responseTimeout <= 0 {
+		return nil
+	}
+	return conn.SetDeadline(time.Now().Add(cli.responseTimeout))
+}
+
+// responseError converts the timeout of a response into a *TimeoutError.
+func (cli *Client) responseError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &TimeoutError{Timeout: cli.responseTimeout}
 	}
+	return err
 }
 
 func (cli *Client) SendRequest(message string) (response string, err error) {
-	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", cli.port))
+	if cli.token != "" && !strings.HasPrefix(message, "{") {
+		message = model.TextTokenPrefix + cli.token + " " + message
+	}
+
+	conn, err := cli.dial()
 	if err != nil {
 		return
 	}
 	defer conn.Close()
 
+	if err = cli.setResponseDeadline(conn); err != nil {
+		return
+	}
 	if _, err = fmt.Fprintln(conn, message); err != nil {
 		return
 	}
 
-	response, err = bufio.NewReader(conn).ReadString('\n')
+	// the Server closes the connection after the response line
+	data, err := io.ReadAll(conn)
 	if err != nil {
-		return
+		return "", cli.responseError(err)
 	}
 
-	return
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// request fills the protocol version and the token of the Request.
+func (cli *Client) request(req model.Request) model.Request {
+	if req.Version == 0 {
+		req.Version = model.ProtocolVersion
+	}
+	if req.Token == "" {
+		req.Token = cli.token
+	}
+	return req
+}
+
+// decodeResponse parses a JSON Response. If the Server reports an error, the Response is returned
+// together with its *model.ProtocolError.
+func decodeResponse(data []byte) (model.Response, error) {
+	var res model.Response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return res, fmt.Errorf("Failed to parse the response of the Server: %s", err)
+	}
+	if res.Error != nil {
+		return res, res.Error
+	}
+	return res, nil
+}
+
+// Do sends a Request using the JSON protocol. If the Server reports an error, the Response is returned
+// together with its *model.ProtocolError.
+func (cli *Client) Do(req model.Request) (model.Response, error) {
+	data, err := json.Marshal(cli.request(req))
+	if err != nil {
+		return model.Response{}, err
+	}
+
+	response, err := cli.SendRequest(string(data))
+	if err != nil {
+		return model.Response{}, err
+	}
+
+	return decodeResponse([]byte(response))
+}
+
+// Commands lists the commands of the Server with their arguments.
+func (cli *Client) Commands() ([]model.CommandInfo, error) {
+	res, err := cli.Do(model.Request{Command: "help"})
+	return res.Commands, err
+}
+
+// Start starts (or restarts) the Scheduler.
+func (cli *Client) Start() (model.Response, error) {
+	return cli.Do(model.Request{Command: "start"})
+}
+
+// Stop stops the Scheduler.
+func (cli *Client) Stop() (model.Response, error) {
+	return cli.Do(model.Request{Command: "stop"})
+}
+
+// Pause pauses or resumes the Scheduler.
+func (cli *Client) Pause() (model.Response, error) {
+	return cli.Do(model.Request{Command: "pause"})
+}
+
+// Back rolls the Scheduler back by the given seconds.
+func (cli *Client) Back(seconds int) (model.Response, error) {
+	return cli.Do(model.Request{Command: "back", Seconds: seconds})
+}
+
+// Forward rolls the Scheduler forward by the given seconds.
+func (cli *Client) Forward(seconds int) (model.Response, error) {
+	return cli.Do(model.Request{Command: "forward", Seconds: seconds})
+}
+
+// Play plays a sound by its name.
+func (cli *Client) Play(name string) (model.Response, error) {
+	return cli.Do(model.Request{Command: "play", Name: name})
+}
+
+// Preview plays the sound effect of an Event by the name of the Event.
+func (cli *Client) Preview(eventName string) (model.Response, error) {
+	return cli.Do(model.Request{Command: "preview", Name: eventName})
+}
+
+// Sounds lists every resolvable sound of the Server.
+func (cli *Client) Sounds() ([]model.SoundInfo, error) {
+	res, err := cli.Do(model.Request{Command: "sounds"})
+	return res.Sounds, err
+}
+
+// Status returns the state of the Server with the next n events (3 if n is 0).
+func (cli *Client) Status(n int) (model.Response, error) {
+	return cli.Do(model.Request{Command: "status", Events: n})
+}
+
+// Timeline returns the computed timeline between the from and to game clocks (e.g. "-1:00" or "12:30"),
+// an empty game clock means the start or the end of the timeline.
+func (cli *Client) Timeline(from string, to string) ([]model.TimelineEntry, error) {
+	res, err := cli.Do(model.Request{Command: "timeline", From: from, To: to})
+	return res.Timeline, err
+}
+
+// Shutdown shuts down the Server.
+func (cli *Client) Shutdown() (model.Response, error) {
+	return cli.Do(model.Request{Command: "shutdown"})
+}
+
+// Watch streams the Notifications of the Scheduler to the handler until the context is done or the Server closes
+// the stream (e.g. when it shuts down), both of which end the stream without an error. The first Notification is
+// a snapshot of the current state. If ticks is set, a tick Notification is streamed every second of the game clock.
+func (cli *Client) Watch(ctx context.Context, ticks bool, handle func(model.Notification)) error {
+	data, err := json.Marshal(cli.request(model.Request{Command: "watch", Ticks: ticks}))
+	if err != nil {
+		return err
+	}
+
+	conn, err := cli.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// closing the connection unblocks the reading of the stream
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stopped:
+		}
+	}()
+
+	if err := cli.setResponseDeadline(conn); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(conn, string(data)); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return cli.responseError(err)
+	}
+	if _, err := decodeResponse(line); err != nil {
+		return err
+	}
+	// the stream has no deadline, it may be idle for long
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var notification model.Notification
+		if err := json.Unmarshal(line, &notification); err != nil {
+			return fmt.Errorf("Failed to parse the Notification of the Server: %s", err)
+		}
+		handle(notification)
+	}
 }
@@ -0,0 +1,172 @@
+package client_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// When the fake Server listens, relative to the request of the Client
+const (
+	listening = iota
+	notListening
+	listeningDuringTheRetries
+)
+
+// listen listens on the loopback port, the listener is closed when the test ends.
+func listen(t *testing.T, port int) net.Listener {
+	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+	return lis
+}
+
+// fakeServer answers every request on the listener with the response, or never if the response is empty.
+// The unanswered connections are held until the test ends.
+func fakeServer(t *testing.T, lis net.Listener, response string) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+					return
+				}
+				if response == "" {
+					<-done
+					return
+				}
+				fmt.Fprintln(conn, response)
+			}()
+		}
+	}()
+}
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+func TestClientErrors(t *testing.T) {
+	require := assert.New(t)
+
+	okResponse := `{"version":1,"ok":true,"message":"Scheduler started","state":"running"}`
+	rejectedResponse := `{"version":1,"ok":false,"error":{"code":"invalid_state","message":"Not now"},"state":"stopped"}`
+
+	testCases := map[string]struct {
+		listen          int
+		response        string
+		retries         int
+		responseTimeout time.Duration
+		requiredMessage string
+		requiredError   any
+	}{
+		"ok":                      {listening, okResponse, 0, time.Second, "Scheduler started", nil},
+		"notRunning":              {notListening, okResponse, 1, time.Second, "", &client.ConnectError{}},
+		"startedDuringTheRetries": {listeningDuringTheRetries, okResponse, 4, time.Second, "Scheduler started", nil},
+		"rejected":                {listening, rejectedResponse, 0, time.Second, "", &model.ProtocolError{}},
+		"noResponse":              {listening, "", 0, 200 * time.Millisecond, "", &client.TimeoutError{}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing client errors, with %s", testCaseName)
+
+		port := freePort(t)
+		if testCase.listen == listening {
+			fakeServer(t, listen(t, port), testCase.response)
+		}
+
+		cli := client.NewClient(port).
+			WithHost("127.0.0.1").
+			WithTimeouts(time.Second, testCase.responseTimeout).
+			WithRetries(testCase.retries, 100*time.Millisecond)
+
+		type result struct {
+			res model.Response
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			res, err := cli.Start()
+			done <- result{res, err}
+		}()
+		if testCase.listen == listeningDuringTheRetries {
+			// the first attempt fails, and the retries wait 1.5s in total, so the Server listens well within them
+			time.Sleep(50 * time.Millisecond)
+			fakeServer(t, listen(t, port), testCase.response)
+		}
+		started := <-done
+		res, err := started.res, started.err
+
+		switch requiredErr := testCase.requiredError.(type) {
+		case nil:
+			require.NoError(err, testCaseName)
+			require.Equal(testCase.requiredMessage, res.Message, testCaseName)
+		case *client.ConnectError:
+			require.ErrorAs(err, &requiredErr, testCaseName)
+			require.Equal(cli.Address(), requiredErr.Address, testCaseName)
+		case *client.TimeoutError:
+			require.ErrorAs(err, &requiredErr, testCaseName)
+			require.Equal(testCase.responseTimeout, requiredErr.Timeout, testCaseName)
+		case *model.ProtocolError:
+			require.ErrorAs(err, &requiredErr, testCaseName)
+			require.Equal(model.ErrorCodeInvalidState, requiredErr.Code, testCaseName)
+			require.Equal("stopped", res.State, testCaseName)
+		}
+	}
+}
+
+func TestLockFileDiscovery(t *testing.T) {
+	require := assert.New(t)
+
+	defaultAddress := fmt.Sprintf("127.0.0.1:%d", model.DefaultPort)
+	testCases := map[string]struct {
+		lock            *model.ServerLock
+		requiredAddress string
+	}{
+		"noLockFile": {nil, defaultAddress},
+		"port":       {&model.ServerLock{PID: 1, Port: 1234}, "127.0.0.1:1234"},
+		"socket":     {&model.ServerLock{PID: 1, Socket: "/tmp/dotkafx.sock"}, "/tmp/dotkafx.sock"},
+		// the Server has not written its port yet
+		"notListening": {&model.ServerLock{PID: 1}, defaultAddress},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing lock file discovery, with %s", testCaseName)
+
+		path := filepath.Join(t.TempDir(), "dotkafx.lock")
+		if testCase.lock != nil {
+			data, err := json.Marshal(testCase.lock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			require.NoError(os.WriteFile(path, data, 0600), testCaseName)
+		}
+
+		cli := client.NewClient(0).WithHost("127.0.0.1").WithLockFile(path)
+		require.Equal(testCase.requiredAddress, cli.Address(), testCaseName)
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConnectError is returned if the Server cannot be reached, typically because it is not running.
+type ConnectError struct {
+	Address string
+	Err     error
+}
+
+func (ce *ConnectError) Error() string {
+	return fmt.Sprintf("The DotkaFX Server is not reachable on %s, is it running? (%s)", ce.Address, ce.Err)
+}
+
+func (ce *ConnectError) Unwrap() error {
+	return ce.Err
+}
+
+// TimeoutError is returned if the Server does not respond in time.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (te *TimeoutError) Error() string {
+	return fmt.Sprintf("The DotkaFX Server did not respond within %s", te.Timeout)
+}
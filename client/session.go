@@ -0,0 +1,86 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// Session is a connection to the Server which is kept open for any number of requests, so an interactive client
+// does not have to dial the Server for every command. A Session is safe for concurrent use, the requests are sent
+// one after the other.
+type Session struct {
+	cli    *Client
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+// Session opens a Session to the Server using the JSON protocol.
+func (cli *Client) Session() (*Session, error) {
+	conn, err := cli.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		cli:    cli,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	if _, err := session.Do(model.Request{Command: "session"}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+// Do sends a Request on the Session and waits for its Response. If the Server reports an error, the Response
+// is returned together with its *model.ProtocolError.
+func (s *Session) Do(req model.Request) (model.Response, error) {
+	data, err := json.Marshal(s.cli.request(req))
+	if err != nil {
+		return model.Response{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the Session may be idle between the requests, only the wait for a response is limited
+	if err := s.cli.setResponseDeadline(s.conn); err != nil {
+		return model.Response{}, err
+	}
+	defer func() {
+		_ = s.conn.SetDeadline(time.Time{})
+	}()
+
+	if _, err := fmt.Fprintln(s.conn, string(data)); err != nil {
+		return model.Response{}, err
+	}
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		var timeoutErr *TimeoutError
+		if errors.As(s.cli.responseError(err), &timeoutErr) {
+			return model.Response{}, timeoutErr
+		}
+		return model.Response{}, fmt.Errorf("The Server closed the session: %s", err)
+	}
+
+	return decodeResponse(line)
+}
+
+// Send sends a command line of the text protocol (e.g. "back 1m24s") on the Session.
+func (s *Session) Send(line string) (model.Response, error) {
+	return s.Do(model.Request{Line: line})
+}
+
+// Close closes the Session.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
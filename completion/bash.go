@@ -0,0 +1,129 @@
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bashHeader is the start of the bash script, FUNC and PROGRAM are replaced with the names of the program.
+// The names are matched case-insensitively and escaped, as event names may contain spaces.
+const bashHeader = `# bash completion of PROGRAM, generated by: PROGRAM completion bash
+# Load it with: source <(PROGRAM completion bash)
+
+# FUNC_names completes the current word with the names listed by: PROGRAM completion <source>
+FUNC_names() {
+    local name word="${cur//\\/}"
+    while IFS= read -r name; do
+        if [[ ${name,,} == "${word,,}"* ]]; then
+            COMPREPLY+=("$(printf '%q' "$name")")
+        fi
+    done < <(PROGRAM "${profile[@]}" completion "$1" 2>/dev/null)
+}
+
+FUNC() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local command="" profile=() args=() i
+    COMPREPLY=()
+
+    # the words before the current one are flags with their values, the command and its arguments
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+`
+
+// bash returns the completion script of bash.
+func bash(spec Spec) string {
+	var b strings.Builder
+	b.WriteString(strings.NewReplacer("FUNC", spec.funcName(), "PROGRAM", spec.Program).Replace(bashHeader))
+
+	for _, flag := range spec.Flags {
+		if flag.Source == SourceProfiles {
+			fmt.Fprintf(&b, "        %s)\n            profile=(--%s \"${COMP_WORDS[i+1]}\")\n            ((i++)) ;;\n",
+				strings.Join(flag.names(), "|"), flag.Long)
+		}
+	}
+	fmt.Fprintf(&b, "        %s)\n            ((i++)) ;;\n", strings.Join(spec.flagNames(true), "|"))
+	b.WriteString("        -*) ;;\n")
+	b.WriteString("        *)\n")
+	b.WriteString("            if [[ -z $command ]]; then\n")
+	b.WriteString("                command=\"${COMP_WORDS[i]}\"\n")
+	b.WriteString("            else\n")
+	b.WriteString("                args+=(\"${COMP_WORDS[i]}\")\n")
+	b.WriteString("            fi ;;\n")
+	b.WriteString("        esac\n    done\n\n")
+
+	// the value of a flag, the flags completed the same way share a case
+	actions := []string{}
+	patterns := map[string][]string{}
+	for _, flag := range spec.Flags {
+		if !flag.Value {
+			continue
+		}
+		action := bashValue(spec, flag)
+		if _, ok := patterns[action]; !ok {
+			actions = append(actions, action)
+		}
+		patterns[action] = append(patterns[action], flag.names()...)
+	}
+	b.WriteString("    case \"$prev\" in\n")
+	for _, action := range actions {
+		fmt.Fprintf(&b, "    %s)\n        %s\n        return ;;\n", strings.Join(patterns[action], "|"), action)
+	}
+	b.WriteString("    esac\n\n")
+
+	fmt.Fprintf(&b, "    if [[ $cur == -* ]]; then\n        COMPREPLY=($(compgen -W %s -- \"$cur\"))\n        return\n    fi\n\n",
+		quote(strings.Join(spec.flagNames(false), " ")))
+	fmt.Fprintf(&b, "    if [[ -z $command ]]; then\n        COMPREPLY=($(compgen -W %s -- \"$cur\"))\n        return\n    fi\n\n",
+		quote(strings.Join(spec.commandNames(), " ")))
+
+	// the arguments of the command, the ones without a completion are left out
+	b.WriteString("    case \"$command\" in\n")
+	for _, cmd := range spec.Commands {
+		cases := []string{}
+		for i, arg := range arguments(cmd) {
+			var action string
+			switch {
+			case arg.source != "":
+				action = fmt.Sprintf("%s_names %s", spec.funcName(), arg.source)
+			case arg.commands:
+				action = fmt.Sprintf("COMPREPLY=($(compgen -W %s -- \"$cur\"))", quote(strings.Join(spec.commandNames(), " ")))
+			case len(arg.words) > 0:
+				action = fmt.Sprintf("COMPREPLY=($(compgen -W %s -- \"$cur\"))", quote(strings.Join(arg.words, " ")))
+			default:
+				continue
+			}
+			cases = append(cases, fmt.Sprintf("        %d) %s ;;\n", i, action))
+		}
+		if len(cases) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s)\n        case ${#args[@]} in\n%s        esac ;;\n", casePattern(names(cmd)), strings.Join(cases, ""))
+	}
+	b.WriteString("    esac\n}\n\n")
+
+	fmt.Fprintf(&b, "complete -F %s %s\n", spec.funcName(), spec.Program)
+	return b.String()
+}
+
+// casePattern returns the pattern of a case matching the names, which are quoted as an alias may be a glob (e.g. ?).
+func casePattern(names []string) string {
+	quoted := []string{}
+	for _, name := range names {
+		quoted = append(quoted, quote(name))
+	}
+	return strings.Join(quoted, "|")
+}
+
+// bashValue returns the completion of the value of a flag.
+func bashValue(spec Spec, flag Flag) string {
+	switch {
+	case flag.Source != "":
+		return fmt.Sprintf("%s_names %s", spec.funcName(), flag.Source)
+	case flag.Files:
+		return "COMPREPLY=($(compgen -f -- \"$cur\"))"
+	case len(flag.Words) > 0:
+		return fmt.Sprintf("COMPREPLY=($(compgen -W %s -- \"$cur\"))", quote(strings.Join(flag.Words, " ")))
+	default:
+		// the value cannot be completed (e.g. a port)
+		return ":"
+	}
+}
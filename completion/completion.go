@@ -0,0 +1,218 @@
+package completion
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// Sources of the dynamic names, the completion scripts list them with: <program> completion <source>
+const (
+	SourceProfiles = "profiles"
+	SourceEvents   = "events"
+	SourceSounds   = "sounds"
+)
+
+// shells are the shells a completion script can be generated for
+var shells = []string{"bash", "zsh", "fish"}
+
+// Flag is a command line option of the application.
+type Flag struct {
+	Long  string
+	Short string
+	Help  string
+	// Value tells whether the flag takes a value
+	Value bool
+	// Files tells whether the value is a path
+	Files bool
+	// Source is the source of the dynamic names the value is completed with
+	Source string
+	// Words are the values of the flag, if it has a fixed set of them
+	Words []string
+}
+
+// names returns the names of the flag as they are written on the command line (e.g. -n and --config-profile-name).
+func (f Flag) names() []string {
+	if f.Short == "" {
+		return []string{"--" + f.Long}
+	}
+	return []string{"-" + f.Short, "--" + f.Long}
+}
+
+// Flags returns the flags of a go-arg command struct, read from the arg and help tags of its fields. The complete tag
+// tells what the value of a flag is completed with: files, a source of dynamic names (e.g. profiles), or the values
+// themselves separated by commas (e.g. text,json).
+func Flags(cmd any) []Flag {
+	flags := []Flag{}
+	cmdType := reflect.TypeOf(cmd)
+	for i := 0; i < cmdType.NumField(); i++ {
+		field := cmdType.Field(i)
+		flag := Flag{
+			Long:  strings.ToLower(field.Name),
+			Help:  field.Tag.Get("help"),
+			Value: field.Type.Kind() != reflect.Bool,
+		}
+
+		positional := false
+		for _, part := range strings.Split(field.Tag.Get("arg"), ",") {
+			switch {
+			case part == "positional":
+				positional = true
+			case strings.HasPrefix(part, "--"):
+				flag.Long = part[2:]
+			case strings.HasPrefix(part, "-"):
+				flag.Short = part[1:]
+			}
+		}
+		if positional {
+			continue
+		}
+
+		switch complete := field.Tag.Get("complete"); complete {
+		case "":
+		case "files":
+			flag.Files = true
+		case SourceProfiles, SourceEvents, SourceSounds:
+			flag.Source = complete
+		default:
+			flag.Words = strings.Split(complete, ",")
+		}
+		flags = append(flags, flag)
+	}
+
+	// go-arg adds the help flag itself
+	return append(flags, Flag{Long: "help", Short: "h", Help: "display this help and exit"})
+}
+
+// Spec is what a completion script completes: the flags and the commands of the program.
+type Spec struct {
+	Program  string
+	Flags    []Flag
+	Commands []model.CommandInfo
+}
+
+// argument is an argument of a command with what it is completed with.
+type argument struct {
+	model.ArgumentInfo
+	// source is the source of the dynamic names the argument is completed with
+	source string
+	// commands tells whether the argument is completed with the names of the commands
+	commands bool
+	// words are the values of the argument, if it has a fixed set of them
+	words []string
+}
+
+// arguments returns the arguments of the command with what they are completed with, like in the REPL: sound names
+// for play, event names for preview, command names for help, the shells for completion, and the switches with
+// their own names. The other arguments (e.g. durations) are only described.
+func arguments(cmd model.CommandInfo) []argument {
+	args := []argument{}
+	for i, info := range cmd.Args {
+		arg := argument{ArgumentInfo: info}
+		switch {
+		case info.Kind == "switch":
+			arg.words = []string{info.Name}
+		case i > 0:
+		case cmd.Name == "play":
+			arg.source = SourceSounds
+		case cmd.Name == "preview":
+			arg.source = SourceEvents
+		case cmd.Name == "help":
+			arg.commands = true
+		case cmd.Name == "completion":
+			arg.words = append(append([]string{}, shells...), SourceProfiles, SourceEvents, SourceSounds)
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// names returns the names of the command with its aliases.
+func names(cmd model.CommandInfo) []string {
+	return append([]string{cmd.Name}, cmd.Aliases...)
+}
+
+// commandNames returns the names of every command with their aliases.
+func (spec Spec) commandNames() []string {
+	all := []string{}
+	for _, cmd := range spec.Commands {
+		all = append(all, names(cmd)...)
+	}
+	return all
+}
+
+// flagNames returns the names of every flag, only the ones with a value if values is set.
+func (spec Spec) flagNames(values bool) []string {
+	all := []string{}
+	for _, flag := range spec.Flags {
+		if flag.Value || !values {
+			all = append(all, flag.names()...)
+		}
+	}
+	return all
+}
+
+// nonIdentifier matches the characters which cannot be used in the name of a shell function
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// funcName returns the prefix of the shell functions of the program.
+func (spec Spec) funcName() string {
+	return "_" + nonIdentifier.ReplaceAllString(spec.Program, "_")
+}
+
+// Generate writes the completion script of the shell (bash, zsh or fish).
+func Generate(w io.Writer, shell string, spec Spec) error {
+	var script string
+	switch shell {
+	case "bash":
+		script = bash(spec)
+	case "zsh":
+		script = zsh(spec)
+	case "fish":
+		script = fish(spec)
+	default:
+		return fmt.Errorf("Unknown shell %s, it has to be one of %s", shell, strings.Join(shells, ", "))
+	}
+	_, err := io.WriteString(w, script)
+	return err
+}
+
+// Names returns the sorted names of the source: the profiles of the config, or the events or the sounds
+// of the given profile.
+func Names(conf model.Config, profileName string, source string) ([]string, error) {
+	list := []string{}
+	switch source {
+	case SourceProfiles:
+		for name := range conf.Profiles {
+			list = append(list, name)
+		}
+	case SourceEvents, SourceSounds:
+		profile, ok := conf.Profiles[profileName]
+		if !ok {
+			return nil, fmt.Errorf("The profile with the name: %s cannot be found in the configuration.", profileName)
+		}
+		if source == SourceEvents {
+			for name := range profile.Events {
+				list = append(list, name)
+			}
+		} else {
+			for name := range profile.AllSoundEffect() {
+				list = append(list, name)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Unknown source of names %s, it has to be %s, %s or %s", source, SourceProfiles, SourceEvents, SourceSounds)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// quote quotes the text for a POSIX shell (bash and zsh).
+func quote(text string) string {
+	return "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+}
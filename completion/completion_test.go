@@ -0,0 +1,148 @@
+package completion_test
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/completion"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+func TestFlags(t *testing.T) {
+	require := assert.New(t)
+
+	flags := map[string]completion.Flag{}
+	for _, flag := range completion.Flags(model.RootCommand{}) {
+		flags[flag.Long] = flag
+	}
+
+	testCases := map[string]struct {
+		long         string
+		requiredFlag completion.Flag
+	}{
+		"shortName":    {"config-profile-name", completion.Flag{Long: "config-profile-name", Short: "n", Value: true, Source: completion.SourceProfiles}},
+		"files":        {"lock-file", completion.Flag{Long: "lock-file", Value: true, Files: true, Help: flags["lock-file"].Help}},
+		"words":        {"output", completion.Flag{Long: "output", Value: true, Words: []string{"text", "json"}, Help: flags["output"].Help}},
+		"switch":       {"spawn", completion.Flag{Long: "spawn", Help: flags["spawn"].Help}},
+		"untaggedName": {"debug", completion.Flag{Long: "debug"}},
+		"help":         {"help", completion.Flag{Long: "help", Short: "h", Help: "display this help and exit"}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing flags, with %s", testCaseName)
+
+		require.Equal(testCase.requiredFlag, flags[testCase.long], testCaseName)
+	}
+
+	_, ok := flags["command"]
+	require.False(ok, "the positional arguments are not flags")
+}
+
+func TestGenerate(t *testing.T) {
+	require := assert.New(t)
+
+	spec := completion.Spec{
+		Program: "dotkafx",
+		Flags:   completion.Flags(model.RootCommand{}),
+		Commands: []model.CommandInfo{
+			{Name: "start", Aliases: []string{"restart"}, Help: "start the Scheduler"},
+			{Name: "back", Help: "roll the Scheduler back", Args: []model.ArgumentInfo{{Name: "seconds", Kind: "duration", Optional: true, Help: "seconds or a duration"}}},
+			{Name: "watch", Help: "stream the events", Args: []model.ArgumentInfo{{Name: "ticks", Kind: "switch", Optional: true}}},
+			{Name: "preview", Help: "play an Event", Args: []model.ArgumentInfo{{Name: "event name", Kind: "name"}}},
+			{Name: "help", Aliases: []string{"?"}, Help: "list the commands", Args: []model.ArgumentInfo{{Name: "command", Kind: "name", Optional: true}}},
+		},
+	}
+
+	testCases := map[string]struct {
+		shell         string
+		requiredLines []string
+	}{
+		"bash": {"bash", []string{
+			"complete -F _dotkafx dotkafx",
+			"    -n|--config-profile-name)\n        _dotkafx_names profiles",
+			"    --output)\n        COMPREPLY=($(compgen -W 'text json' -- \"$cur\"))",
+			"COMPREPLY=($(compgen -W 'start restart back watch preview help ?' -- \"$cur\"))",
+			"    'preview')\n        case ${#args[@]} in\n        0) _dotkafx_names events ;;",
+			"    'help'|'?')",
+		}},
+		"zsh": {"zsh", []string{
+			"#compdef dotkafx",
+			"'(-n --config-profile-name)'{-n,--config-profile-name}':config profile name:_dotkafx_names profiles profile'",
+			"'--output[format of the response printed by the client\\: text or json]:output:(text json)'",
+			"    'restart:start the Scheduler'",
+			"      2) _message 'seconds: seconds or a duration' ;;",
+			"      2) _wanted values expl 'ticks' compadd ticks ;;",
+			"      2) _dotkafx_names events 'event name' ;;",
+		}},
+		"fish": {"fish", []string{
+			"complete -c dotkafx -l config-profile-name -s n -x -a '(_dotkafx_names profiles)'",
+			"complete -c dotkafx -l lock-file -r -F",
+			"complete -c dotkafx -n _dotkafx_needs_command -a 'restart' -d 'start the Scheduler'",
+			"complete -c dotkafx -n '_dotkafx_arg 0 \\'preview\\'' -a '(_dotkafx_names events)'",
+			"complete -c dotkafx -n '_dotkafx_arg 0 \\'help\\' \\'?\\'' -a 'start restart back watch preview help ?'",
+		}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing generate, with %s", testCaseName)
+
+		var script strings.Builder
+		require.NoError(completion.Generate(&script, testCase.shell, spec), testCaseName)
+		for _, line := range testCase.requiredLines {
+			require.Contains(script.String(), line, testCaseName)
+		}
+
+		// the syntax is checked by the shell itself, if it is installed
+		if _, err := exec.LookPath(testCase.shell); err == nil && testCase.shell != "fish" {
+			check := exec.Command(testCase.shell, "-n")
+			check.Stdin = strings.NewReader(script.String())
+			output, err := check.CombinedOutput()
+			require.NoError(err, "%s: %s", testCaseName, output)
+		}
+	}
+
+	err := completion.Generate(&strings.Builder{}, "powershell", spec)
+	require.EqualError(err, "Unknown shell powershell, it has to be one of bash, zsh, fish")
+}
+
+func TestNames(t *testing.T) {
+	require := assert.New(t)
+
+	conf := model.Config{Profiles: map[string]model.ConfigProfile{
+		"default": {Events: map[string]model.Event{
+			"Power Rune":   {SoundEffect: "power_rune_appeared"},
+			"Bounty Runes": {SoundEffect: "bounty_runes_appeared"},
+			"Wisdom Rune":  {SoundEffect: "power_rune_appeared"},
+		}},
+		"turbo": {},
+	}}
+
+	testCases := map[string]struct {
+		profile       string
+		source        string
+		requiredNames []string
+		requiredError string
+	}{
+		"profiles":       {"default", completion.SourceProfiles, []string{"default", "turbo"}, ""},
+		"events":         {"default", completion.SourceEvents, []string{"Bounty Runes", "Power Rune", "Wisdom Rune"}, ""},
+		"sounds":         {"default", completion.SourceSounds, []string{"bounty_runes_appeared", "power_rune_appeared"}, ""},
+		"emptyProfile":   {"turbo", completion.SourceEvents, []string{}, ""},
+		"unknownProfile": {"ranked", completion.SourceEvents, nil, "The profile with the name: ranked cannot be found in the configuration."},
+		"unknownSource":  {"default", "heroes", nil, "Unknown source of names heroes, it has to be profiles, events or sounds"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing names, with %s", testCaseName)
+
+		names, err := completion.Names(conf, testCase.profile, testCase.source)
+		if testCase.requiredError != "" {
+			require.EqualError(err, testCase.requiredError, testCaseName)
+			continue
+		}
+		require.NoError(err, testCaseName)
+		require.Equal(testCase.requiredNames, names, testCaseName)
+	}
+}
@@ -0,0 +1,141 @@
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fishHeader is the start of the fish script, FUNC and PROGRAM are replaced with the names of the program,
+// VALUEFLAGS with the flags taking a value and PROFILEFLAGS with the flags selecting the profile.
+const fishHeader = `# fish completion of PROGRAM, generated by: PROGRAM completion fish
+# Save it as PROGRAM.fish in ~/.config/fish/completions, or load it with: PROGRAM completion fish | source
+
+# FUNC_words prints the words after the flags: the command and its arguments
+function FUNC_words
+    set -l skip 0
+    set -l found 0
+    for token in (commandline -opc)[2..-1]
+        if test $skip = 1
+            set skip 0
+        else if test $found = 1
+            echo $token
+        else
+            switch $token
+                case VALUEFLAGS
+                    set skip 1
+                case '-*'
+                case '*'
+                    set found 1
+                    echo $token
+            end
+        end
+    end
+end
+
+# FUNC_needs_command tells whether the command is not written yet
+function FUNC_needs_command
+    test (count (FUNC_words)) -eq 0
+end
+
+# FUNC_arg tells whether the argument with the index (from 0) of one of the commands is completed
+function FUNC_arg
+    set -l words (FUNC_words)
+    test (count $words) -eq (math $argv[1] + 1); and contains -- $words[1] $argv[2..-1]
+end
+
+# FUNC_names prints the names listed by: PROGRAM completion <source>, of the profile on the command line
+function FUNC_names
+    set -l tokens (commandline -opc)
+    set -l profile
+    for i in (seq (count $tokens))
+        switch $tokens[$i]
+            case PROFILEFLAGS
+                set profile --config-profile-name $tokens[(math $i + 1)]
+        end
+    end
+    PROGRAM $profile completion $argv[1] 2>/dev/null
+end
+
+complete -c PROGRAM -f
+`
+
+// fish returns the completion script of fish.
+func fish(spec Spec) string {
+	profileFlags := []string{}
+	for _, flag := range spec.Flags {
+		if flag.Source == SourceProfiles {
+			profileFlags = append(profileFlags, flag.names()...)
+		}
+	}
+	if len(profileFlags) == 0 {
+		// no flag selects the profile, the pattern matches nothing
+		profileFlags = []string{"''"}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.NewReplacer(
+		"FUNC", spec.funcName(),
+		"PROGRAM", spec.Program,
+		"VALUEFLAGS", strings.Join(spec.flagNames(true), " "),
+		"PROFILEFLAGS", strings.Join(profileFlags, " "),
+	).Replace(fishHeader))
+
+	b.WriteString("\n# flags\n")
+	for _, flag := range spec.Flags {
+		line := fmt.Sprintf("complete -c %s -l %s", spec.Program, flag.Long)
+		if flag.Short != "" {
+			line += " -s " + flag.Short
+		}
+		switch {
+		case flag.Source != "":
+			line += fmt.Sprintf(" -x -a '(%s_names %s)'", spec.funcName(), flag.Source)
+		case flag.Files:
+			line += " -r -F"
+		case len(flag.Words) > 0:
+			line += " -x -a " + fishQuote(strings.Join(flag.Words, " "))
+		case flag.Value:
+			line += " -x"
+		}
+		if flag.Help != "" {
+			line += " -d " + fishQuote(flag.Help)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n# commands\n")
+	for _, cmd := range spec.Commands {
+		for _, name := range names(cmd) {
+			fmt.Fprintf(&b, "complete -c %s -n %s_needs_command -a %s -d %s\n", spec.Program, spec.funcName(), fishQuote(name), fishQuote(cmd.Help))
+		}
+	}
+
+	b.WriteString("\n# arguments of the commands\n")
+	for _, cmd := range spec.Commands {
+		for i, arg := range arguments(cmd) {
+			var values string
+			switch {
+			case arg.source != "":
+				values = fmt.Sprintf("'(%s_names %s)'", spec.funcName(), arg.source)
+			case arg.commands:
+				values = fishQuote(strings.Join(spec.commandNames(), " "))
+			case len(arg.words) > 0:
+				values = fishQuote(strings.Join(arg.words, " "))
+			default:
+				continue
+			}
+			// the names are quoted, as an alias may be a glob (e.g. ?)
+			quoted := []string{}
+			for _, name := range names(cmd) {
+				quoted = append(quoted, fishQuote(name))
+			}
+			condition := fmt.Sprintf("%s_arg %d %s", spec.funcName(), i, strings.Join(quoted, " "))
+			fmt.Fprintf(&b, "complete -c %s -n %s -a %s -d %s\n", spec.Program, fishQuote(condition), values, fishQuote(arg.Help))
+		}
+	}
+	return b.String()
+}
+
+// fishQuote quotes the text for fish, which escapes the quotes (and the backslashes) in a quoted text.
+func fishQuote(text string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(text) + "'"
+}
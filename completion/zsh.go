@@ -0,0 +1,121 @@
+package completion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zshHeader is the start of the zsh script, FUNC and PROGRAM are replaced with the names of the program.
+const zshHeader = `#compdef PROGRAM
+# zsh completion of PROGRAM, generated by: PROGRAM completion zsh
+# Save it as FUNC in a folder of $fpath, or load it with: source <(PROGRAM completion zsh)
+
+# FUNC_names completes the names listed by: PROGRAM completion <source>
+FUNC_names() {
+  local -a names expl
+  names=("${(@f)$(PROGRAM "${profile[@]}" completion $1 2>/dev/null)}")
+  _wanted $1 expl "$2" compadd -M 'm:{a-zA-Z}={A-Za-z}' -a names
+}
+
+FUNC() {
+  local -a profile commands
+  local i state line curcontext="$curcontext"
+  typeset -A opt_args
+
+  # the profile on the command line selects the events and the sounds
+  for ((i = 2; i < CURRENT; i++)); do
+    case $words[i] in
+`
+
+// zsh returns the completion script of zsh.
+func zsh(spec Spec) string {
+	var b strings.Builder
+	b.WriteString(strings.NewReplacer("FUNC", spec.funcName(), "PROGRAM", spec.Program).Replace(zshHeader))
+
+	for _, flag := range spec.Flags {
+		if flag.Source == SourceProfiles {
+			fmt.Fprintf(&b, "      %s) profile=(--%s \"$words[i+1]\") ;;\n", strings.Join(flag.names(), "|"), flag.Long)
+		}
+	}
+	b.WriteString("    esac\n  done\n\n")
+
+	b.WriteString("  commands=(\n")
+	for _, cmd := range spec.Commands {
+		for _, name := range names(cmd) {
+			fmt.Fprintf(&b, "    %s\n", quote(strings.ReplaceAll(name, ":", `\:`)+":"+cmd.Help))
+		}
+	}
+	b.WriteString("  )\n\n")
+
+	b.WriteString("  _arguments -C \\\n")
+	for _, flag := range spec.Flags {
+		option := zshValue(spec, flag)
+		if flag.Help != "" {
+			option = "[" + zshEscape(flag.Help) + "]" + option
+		}
+		if flag.Short == "" {
+			fmt.Fprintf(&b, "    %s \\\n", quote("--"+flag.Long+option))
+		} else {
+			fmt.Fprintf(&b, "    '(-%s --%s)'{-%s,--%s}%s \\\n", flag.Short, flag.Long, flag.Short, flag.Long, quote(option))
+		}
+	}
+	b.WriteString("    '1:command:->command' \\\n")
+	b.WriteString("    '*::argument:->argument'\n\n")
+
+	b.WriteString("  case $state in\n")
+	b.WriteString("  command)\n    _describe -t commands command commands ;;\n")
+	b.WriteString("  argument)\n    case $words[1] in\n")
+	for _, cmd := range spec.Commands {
+		args := arguments(cmd)
+		if len(args) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "    %s)\n      case $CURRENT in\n", casePattern(names(cmd)))
+		for i, arg := range args {
+			var action string
+			switch {
+			case arg.source != "":
+				action = fmt.Sprintf("%s_names %s %s", spec.funcName(), arg.source, quote(arg.Name))
+			case arg.commands:
+				action = "_describe -t commands command commands"
+			case len(arg.words) > 0:
+				action = fmt.Sprintf("_wanted values expl %s compadd %s", quote(arg.Name), strings.Join(arg.words, " "))
+			default:
+				action = fmt.Sprintf("_message %s", quote(arg.Name+": "+arg.Help))
+			}
+			// the first argument is the second word after the command
+			fmt.Fprintf(&b, "      %d) %s ;;\n", i+2, action)
+		}
+		b.WriteString("      esac ;;\n")
+	}
+	b.WriteString("    esac ;;\n  esac\n}\n\n")
+
+	// autoloaded from $fpath the function completes right away, sourced it is registered
+	fmt.Fprintf(&b, "if [ \"$funcstack[1]\" = %s ]; then\n  %s \"$@\"\nelse\n  compdef %s %s\nfi\n",
+		quote(spec.funcName()), spec.funcName(), spec.funcName(), spec.Program)
+	return b.String()
+}
+
+// zshValue returns the message and the completion of the value of a flag in the syntax of _arguments.
+func zshValue(spec Spec, flag Flag) string {
+	if !flag.Value {
+		return ""
+	}
+	message := ":" + strings.ReplaceAll(flag.Long, "-", " ") + ":"
+	switch {
+	case flag.Source != "":
+		return message + fmt.Sprintf("%s_names %s %s", spec.funcName(), flag.Source, strings.TrimSuffix(flag.Source, "s"))
+	case flag.Files:
+		return message + "_files"
+	case len(flag.Words) > 0:
+		return message + "(" + strings.Join(flag.Words, " ") + ")"
+	default:
+		// the value cannot be completed (e.g. a port), only its message is shown
+		return message + " "
+	}
+}
+
+// zshEscape escapes the characters of a description which have a meaning in the option specs of _arguments.
+func zshEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(text)
+}
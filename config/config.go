@@ -1,8 +1,8 @@
 package config
 
 import (
-	"dotkafx/log"
-	"dotkafx/model"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
 	"os"
 	"path/filepath"
 
@@ -12,26 +12,28 @@ import (
 const configFile = "dotkafx_config.yml"
 
 // GetConfigData will check the Home folder, of the user running the application, for the dotkafx_config.yml file,
-// and return its content. If the file cannot be found (first time run) then it will be created with the defaultConfig data.
-func GetConfigData(defaultConfig []byte) ([]byte, error) {
+// and return its content and path. If the file cannot be found (first time run) then it will be created with the defaultConfig data.
+// The path is empty if the Home folder cannot be found, and the defaultConfig is used without a file.
+func GetConfigData(defaultConfig []byte) ([]byte, string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		log.Error("Failed to find Home folder: %s", err)
-		return defaultConfig, nil
+		return defaultConfig, "", nil
 	}
 
 	configFilePath := filepath.Join(homeDir, configFile)
 	if _, err := os.Stat(configFilePath); err == nil {
-		return os.ReadFile(configFilePath)
+		data, err := os.ReadFile(configFilePath)
+		return data, configFilePath, err
 	} else {
 		log.Warn("Failed to read config file in Home folder: %s", err)
 	}
 
 	if err := os.WriteFile(configFilePath, defaultConfig, 0644); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return defaultConfig, nil
+	return defaultConfig, configFilePath, nil
 }
 
 // CreateConfig accepts the content of a file as argument, and creates the application configuration object from it.
@@ -44,3 +46,28 @@ func CreateConfig(configData []byte) (model.Config, error) {
 
 	return inputConf.Parse()
 }
+
+// ReadConfig returns the configuration of the config file in the Home folder, or of the defaultConfig if there is
+// no such file. Unlike GetConfigData it neither creates the file nor logs anything, so the shell completion stays quiet.
+func ReadConfig(defaultConfig []byte) (model.Config, error) {
+	data := defaultConfig
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if fileData, err := os.ReadFile(filepath.Join(homeDir, configFile)); err == nil {
+			data = fileData
+		}
+	}
+	return CreateConfig(data)
+}
+
+// lockFile is the name of the lock file of the Server in the Home folder
+const lockFile = ".dotkafx.lock"
+
+// DefaultLockFile returns the path of the lock file of the Server in the Home folder of the user running
+// the application, or in the temp folder if the Home folder cannot be found.
+func DefaultLockFile() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), lockFile)
+	}
+	return filepath.Join(homeDir, lockFile)
+}
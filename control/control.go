@@ -0,0 +1,200 @@
+// Package control is the Go API of the DotkaFX Server. Its Client starts, pauses and rolls the Scheduler, reads
+// the Status of the Server and watches its Notifications, returning Go types and typed errors, so a tool can
+// control the Server without running the dotkafx executable:
+//
+//	cli := control.New(control.Options{})
+//	status, err := cli.Forward(30 * time.Second)
+//	var notRunning *control.NotRunningError
+//	if errors.As(err, &notRunning) {
+//		// the Server is not running
+//	}
+//
+// The controltest package has a fake Server for the tests of such tools.
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/config"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// DefaultResponseTimeout is the time the Client waits for a response of the Server
+	DefaultResponseTimeout = 10 * time.Second
+	// watchBuffer is the number of Notifications buffered for a slow reader of a Watcher
+	watchBuffer = 64
+)
+
+// Options tell the Client where the Server is and how long to wait for it. The zero Options reach the Server
+// of this machine, finding its port in its lock file.
+type Options struct {
+	// Host is the host of the Server, localhost by default
+	Host string
+	// Port is the TCP Port of the Server, found in the LockFile by default
+	Port int
+	// Socket is the path of the Unix domain socket of the Server, it is dialed instead of the TCP Port if it is set
+	Socket string
+	// Token is the shared secret of the Server, if it is run with one
+	Token string
+	// LockFile is the lock file of the Server, .dotkafx.lock in the Home folder by default
+	LockFile string
+	// ConnectTimeout is the time the Client waits for a connection, client.DefaultConnectTimeout by default
+	ConnectTimeout time.Duration
+	// ResponseTimeout is the time the Client waits for a response, DefaultResponseTimeout by default
+	ResponseTimeout time.Duration
+	// Retries is the number of times the Client retries to connect
+	Retries int
+}
+
+// Client controls a DotkaFX Server. It opens a connection for every command, so it can be used concurrently.
+type Client struct {
+	cli *client.Client
+}
+
+// New creates a Client of the Server described by the Options.
+func New(opts Options) *Client {
+	if opts.LockFile == "" {
+		opts.LockFile = config.DefaultLockFile()
+	}
+	if opts.ConnectTimeout == 0 {
+		opts.ConnectTimeout = client.DefaultConnectTimeout
+	}
+	if opts.ResponseTimeout == 0 {
+		opts.ResponseTimeout = DefaultResponseTimeout
+	}
+
+	cli := client.NewClient(opts.Port).
+		WithToken(opts.Token).
+		WithTimeouts(opts.ConnectTimeout, opts.ResponseTimeout).
+		WithRetries(opts.Retries, client.DefaultRetryBackoff).
+		WithLockFile(opts.LockFile)
+	if opts.Host != "" {
+		cli.WithHost(opts.Host)
+	}
+	if opts.Socket != "" {
+		cli.WithSocket(opts.Socket)
+	}
+	return &Client{cli: cli}
+}
+
+// Address returns the address the Client dials.
+func (c *Client) Address() string {
+	return c.cli.Address()
+}
+
+// do sends the Request and converts its Response. If the Server rejects the command, the Status is returned
+// together with the *CommandError, as the Server sends the state of the Scheduler with its errors too.
+func (c *Client) do(req model.Request) (Status, error) {
+	res, err := c.cli.Do(req)
+	return newStatus(res), err
+}
+
+// seconds converts the amount of a back or forward command, the Server rolls the Scheduler by whole seconds.
+// The error is the one the Server responds with to an amount under 1 second.
+func seconds(amount time.Duration, command string) (int, error) {
+	if amount < time.Second {
+		return 0, model.NewProtocolError(model.ErrorCodeInvalidArgument,
+			"Invalid value for [seconds]: %s is less than 1 second (usage: %s [seconds])", amount, command)
+	}
+	return int(amount.Round(time.Second) / time.Second), nil
+}
+
+// Start starts the Scheduler, or restarts it from the beginning of the countdown.
+func (c *Client) Start() (Status, error) {
+	return c.do(model.Request{Command: "start"})
+}
+
+// Stop stops the Scheduler without the possibility of resuming.
+func (c *Client) Stop() (Status, error) {
+	return c.do(model.Request{Command: "stop"})
+}
+
+// Pause pauses the running Scheduler, or resumes the paused one.
+func (c *Client) Pause() (Status, error) {
+	return c.do(model.Request{Command: "pause"})
+}
+
+// Back rolls the running Scheduler back by the amount, rounded to seconds.
+func (c *Client) Back(amount time.Duration) (Status, error) {
+	n, err := seconds(amount, "back")
+	if err != nil {
+		return Status{}, err
+	}
+	return c.do(model.Request{Command: "back", Seconds: n})
+}
+
+// Forward rolls the running Scheduler forward by the amount, rounded to seconds.
+func (c *Client) Forward(amount time.Duration) (Status, error) {
+	n, err := seconds(amount, "forward")
+	if err != nil {
+		return Status{}, err
+	}
+	return c.do(model.Request{Command: "forward", Seconds: n})
+}
+
+// Status returns the state of the Scheduler with the next events and the description of the Server.
+func (c *Client) Status() (Status, error) {
+	return c.do(model.Request{Command: "status"})
+}
+
+// Play plays a sound by its name (e.g. bounty_runes_appeared or tone:880hz:200ms).
+func (c *Client) Play(name string) (Status, error) {
+	return c.do(model.Request{Command: "play", Name: name})
+}
+
+// Preview plays the sound effect of an Event by the name of the Event.
+func (c *Client) Preview(eventName string) (Status, error) {
+	return c.do(model.Request{Command: "preview", Name: eventName})
+}
+
+// Shutdown shuts down the Server.
+func (c *Client) Shutdown() (Status, error) {
+	return c.do(model.Request{Command: "shutdown"})
+}
+
+// Watcher receives the Notifications of the Server.
+type Watcher struct {
+	// Notifications receives the Notifications, it is closed when the stream ends
+	Notifications <-chan Notification
+	done          chan struct{}
+	err           error
+}
+
+// Err waits until the stream ends, and returns the error which ended it. The stream ends without an error if its
+// context is done or the Server closes it (e.g. when it shuts down).
+func (w *Watcher) Err() error {
+	<-w.done
+	return w.err
+}
+
+// Watch streams the Notifications of the Server until the context is done or the Server closes the stream.
+// The first Notification is a snapshot of the current state. The Notifications have to be read (or the context
+// canceled), the stream waits for the reader.
+func (c *Client) Watch(ctx context.Context) *Watcher {
+	return c.watch(ctx, false)
+}
+
+// WatchTicks is Watch with a Notification of the Tick kind every second of the game clock.
+func (c *Client) WatchTicks(ctx context.Context) *Watcher {
+	return c.watch(ctx, true)
+}
+
+func (c *Client) watch(ctx context.Context, ticks bool) *Watcher {
+	notifications := make(chan Notification, watchBuffer)
+	w := &Watcher{Notifications: notifications, done: make(chan struct{})}
+
+	go func() {
+		defer close(w.done)
+		defer close(notifications)
+		w.err = c.cli.Watch(ctx, ticks, func(notification model.Notification) {
+			select {
+			case notifications <- newNotification(notification):
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return w
+}
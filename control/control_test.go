@@ -0,0 +1,204 @@
+package control_test
+
+import (
+	"context"
+	"embed"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/control"
+	"github.com/DonBattery/dotkafx/control/controltest"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+// outcome is the result of a command, without the details of the Server which differ between two Servers.
+type outcome struct {
+	status control.Status
+	err    string
+}
+
+// startServer serves a real Server with the profile of the fake Server and a stopped clock until the test ends,
+// and returns a Client of it.
+func startServer(t *testing.T) *control.Client {
+	profile := model.ConfigProfile{
+		Name:        controltest.Profile,
+		Countdown:   int(controltest.Countdown / time.Second),
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			controltest.Event: {FirstHappensAt: 180, Interval: 180, SoundEffect: controltest.Sound},
+		},
+	}
+	sch := scheduler.NewScheduler(profile, nil).WithTicks(make(chan time.Time))
+	srv := server.NewServer(sound.NewPlayer(embed.FS{}, nil), sch, model.RootCommand{Listen: "127.0.0.1"}, embed.FS{})
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return control.New(control.Options{Host: "127.0.0.1", Port: srv.Addr().(*net.TCPAddr).Port, ResponseTimeout: 5 * time.Second})
+}
+
+// runClient runs the commands of TestClient, and returns their outcomes.
+func runClient(t *testing.T, cli *control.Client, serverName string) []outcome {
+	require := assert.New(t)
+
+	testCases := []struct {
+		name             string
+		run              func() (control.Status, error)
+		requiredState    control.State
+		requiredGameTime time.Duration
+		requiredCode     string
+	}{
+		{"pauseWhileStopped", cli.Pause, control.StateStopped, -time.Minute, control.CodeInvalidState},
+		{"backWhileStopped", func() (control.Status, error) { return cli.Back(time.Second) }, control.StateStopped, -time.Minute, control.CodeInvalidState},
+		{"start", cli.Start, control.StateRunning, -time.Minute, ""},
+		{"forward", func() (control.Status, error) { return cli.Forward(90 * time.Second) }, control.StateRunning, 30 * time.Second, ""},
+		{"back", func() (control.Status, error) { return cli.Back(10 * time.Second) }, control.StateRunning, 20 * time.Second, ""},
+		{"backBeforeTheCountdown", func() (control.Status, error) { return cli.Back(5 * time.Minute) }, control.StateRunning, -time.Minute, ""},
+		{"forwardTooLittle", func() (control.Status, error) { return cli.Forward(time.Millisecond) }, "", 0, control.CodeInvalidArgument},
+		{"forwardTooMuch", func() (control.Status, error) { return cli.Forward(time.Hour) }, control.StateRunning, -time.Minute, control.CodeInvalidArgument},
+		{"pause", cli.Pause, control.StatePaused, -time.Minute, ""},
+		{"status", cli.Status, control.StatePaused, -time.Minute, ""},
+		{"resume", cli.Pause, control.StateRunning, -time.Minute, ""},
+		{"stop", cli.Stop, control.StateStopped, -time.Minute, ""},
+		{"stopWhileStopped", cli.Stop, control.StateStopped, -time.Minute, control.CodeInvalidState},
+		{"play", func() (control.Status, error) { return cli.Play(controltest.Sound) }, control.StateStopped, -time.Minute, ""},
+		{"unknownEvent", func() (control.Status, error) { return cli.Preview("Roshan") }, control.StateStopped, -time.Minute, control.CodeInvalidArgument},
+	}
+
+	outcomes := []outcome{}
+	for _, testCase := range testCases {
+		t.Logf("Testing client, with %s on the %s", testCase.name, serverName)
+
+		status, err := testCase.run()
+		if testCase.requiredCode != "" {
+			var commandErr *control.CommandError
+			require.ErrorAs(err, &commandErr, testCase.name)
+			require.Equal(testCase.requiredCode, commandErr.Code, testCase.name)
+		} else {
+			require.NoError(err, testCase.name)
+			require.NotEmpty(status.Message, testCase.name)
+		}
+		require.Equal(testCase.requiredState, status.State, testCase.name)
+		require.Equal(testCase.requiredGameTime, status.GameTime, testCase.name)
+
+		status.Server = nil
+		message := ""
+		if err != nil {
+			message = err.Error()
+		}
+		outcomes = append(outcomes, outcome{status, message})
+	}
+	return outcomes
+}
+
+func TestClient(t *testing.T) {
+	require := assert.New(t)
+
+	srv := controltest.NewServer()
+	defer srv.Close()
+	cli := srv.Client()
+
+	// the fake Server answers exactly like a real one
+	outcomes := runClient(t, cli, "fake Server")
+	require.Equal(runClient(t, startServer(t), "real Server"), outcomes)
+	require.Equal("invalid_state: The back command cannot be used while the Scheduler is stopped, it has to be running", outcomes[1].err)
+
+	status, err := cli.Status()
+	require.NoError(err)
+	require.Equal(controltest.Profile, status.Server.Profile)
+	require.Equal("-00:01:00", status.GameClock)
+
+	// the amounts which are too little are rejected before they are sent
+	require.Equal([]string{"pause", "back", "start", "forward", "back", "back", "forward", "pause", "status", "pause", "stop",
+		"stop", "play", "preview", "status"}, srv.Commands())
+	require.Equal(90, srv.Requests()[3].Seconds)
+}
+
+func TestClientErrors(t *testing.T) {
+	require := assert.New(t)
+
+	srv := controltest.NewServer()
+	cli := srv.Client()
+
+	t.Logf("Testing client errors, with %s", "injectedFailure")
+	srv.Fail("play", &control.CommandError{Code: control.CodeSoundError, Message: "No speaker"})
+	_, err := cli.Play("beep")
+	var commandErr *control.CommandError
+	require.ErrorAs(err, &commandErr)
+	require.Equal(control.CodeSoundError, commandErr.Code)
+	srv.Fail("play", nil)
+	status, err := cli.Play(controltest.Sound)
+	require.NoError(err)
+	require.Equal("Playing tone:double (0.4s)", status.Message)
+
+	t.Logf("Testing client errors, with %s", "notRunning")
+	srv.Close()
+	_, err = cli.Start()
+	var notRunning *control.NotRunningError
+	require.ErrorAs(err, &notRunning)
+	require.Equal(cli.Address(), notRunning.Address)
+}
+
+func TestWatch(t *testing.T) {
+	require := assert.New(t)
+
+	srv := controltest.NewServer()
+	defer srv.Close()
+	cli := srv.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := cli.Watch(ctx)
+
+	next := func() control.Notification {
+		select {
+		case notification := <-watcher.Notifications:
+			return notification
+		case <-time.After(2 * time.Second):
+			t.Fatal("no Notification received")
+			return control.Notification{}
+		}
+	}
+
+	snapshot := next()
+	require.Equal(control.KindState, snapshot.Kind)
+	require.Equal(control.StateStopped, snapshot.State)
+
+	_, err := cli.Start()
+	require.NoError(err)
+	require.Equal(control.KindStarted, next().Kind)
+
+	_, err = cli.Forward(4 * time.Minute)
+	require.NoError(err)
+	rolled := next()
+	require.Equal(control.KindRolledForward, rolled.Kind)
+	require.Equal(4*time.Minute, rolled.Amount)
+	require.Equal(3*time.Minute, rolled.GameTime)
+
+	srv.Notify(control.Notification{Kind: control.KindEvent, Event: "Bounty Runes", Occurrence: 2})
+	event := next()
+	require.Equal("[00:03:00] event: Bounty Runes #2", event.String())
+	require.Equal(control.StateRunning, event.State)
+
+	// the stream ends without an error when the Server shuts down
+	_, err = cli.Shutdown()
+	require.NoError(err)
+	for range watcher.Notifications {
+	}
+	require.NoError(watcher.Err())
+}
@@ -0,0 +1,265 @@
+// Package controltest has a fake DotkaFX Server for the tests of the tools built on the control package:
+//
+//	srv := controltest.NewServer()
+//	defer srv.Close()
+//	status, err := srv.Client().Start()
+//
+// The fake Server is the real Server with a silent player and a stopped clock, so it answers exactly like the real
+// one, but the tests are deterministic: the state and the game time only change by the commands and by SetState.
+// It runs the real Server, so the tests need the build dependencies of the sound package (cgo, and ALSA on Linux).
+package controltest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/control"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+	"github.com/DonBattery/dotkafx/tools"
+)
+
+const (
+	// Countdown is the countdown of the fake Server, a started Scheduler is at -Countdown on the game clock
+	Countdown = time.Minute
+	// Profile is the name of the profile of the fake Server
+	Profile = "fake"
+	// Event is the Event of the profile, it happens every 3 minutes from 00:03:00 with a generated tone
+	Event = "Bounty Runes"
+	// Sound is a sound the fake Server can play, it is generated so it needs no sound files
+	Sound = "tone:double"
+)
+
+// Server is a fake DotkaFX Server listening on a loopback port. In front of the real Server it records the
+// Requests of the JSON protocol (the control package uses nothing else) and rejects the commands made to fail.
+type Server struct {
+	lis    net.Listener
+	srv    *server.Server
+	sch    *scheduler.Scheduler
+	cancel context.CancelFunc
+	// served is closed when the real Server has shut down
+	served chan struct{}
+
+	mu       sync.Mutex
+	requests []model.Request
+	failures map[string]*control.CommandError
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a fake Server with a stopped Scheduler. It panics if it cannot listen on a loopback port.
+func NewServer() *Server {
+	profile := model.ConfigProfile{
+		Name:        Profile,
+		Countdown:   int(Countdown / time.Second),
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			Event: {FirstHappensAt: 180, Interval: 180, SoundEffect: Sound},
+		},
+	}
+	// the speaker is never initialized, so the sounds are not heard, and no sound file is embedded
+	embedded := fstest.MapFS{"embedded_sounds": &fstest.MapFile{Mode: fs.ModeDir}}
+	// the clock never ticks
+	sch := scheduler.NewScheduler(profile, nil).WithTicks(make(chan time.Time))
+	srv := server.NewServer(sound.NewPlayer(embedded, nil), sch, model.RootCommand{Listen: "127.0.0.1"}, fstest.MapFS{})
+	if err := srv.Listen(); err != nil {
+		panic(fmt.Sprintf("Failed to listen on a loopback port: %s", err))
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to listen on a loopback port: %s", err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fake := &Server{
+		lis:      lis,
+		srv:      srv,
+		sch:      sch,
+		cancel:   cancel,
+		served:   make(chan struct{}),
+		failures: make(map[string]*control.CommandError),
+	}
+	go func() {
+		defer close(fake.served)
+		_ = srv.Serve(ctx)
+		// after a shutdown command the Clients get a *control.NotRunningError too
+		_ = lis.Close()
+	}()
+	fake.wg.Add(1)
+	go fake.serve()
+	return fake
+}
+
+// Port returns the TCP Port of the fake Server.
+func (srv *Server) Port() int {
+	return srv.lis.Addr().(*net.TCPAddr).Port
+}
+
+// Options returns the Options of a Client of the fake Server.
+func (srv *Server) Options() control.Options {
+	return control.Options{Host: "127.0.0.1", Port: srv.Port(), ResponseTimeout: 5 * time.Second}
+}
+
+// Client returns a Client of the fake Server.
+func (srv *Server) Client() *control.Client {
+	return control.New(srv.Options())
+}
+
+// Close stops the fake Server and ends the streams of the watchers. After Close the Clients get a
+// *control.NotRunningError, like when the real Server is not running.
+func (srv *Server) Close() {
+	srv.cancel()
+	<-srv.served
+	srv.wg.Wait()
+}
+
+// Requests returns the Requests received by the fake Server, the oldest first.
+func (srv *Server) Requests() []model.Request {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]model.Request{}, srv.requests...)
+}
+
+// Commands returns the commands of the Requests received by the fake Server, the oldest first.
+func (srv *Server) Commands() []string {
+	commands := []string{}
+	for _, req := range srv.Requests() {
+		commands = append(commands, req.Command)
+	}
+	return commands
+}
+
+// SetState brings the Scheduler into the state at the game time with its commands, so the watchers get their
+// Notifications. The game time is at least -Countdown, like after a start.
+func (srv *Server) SetState(state control.State, gameTime time.Duration) {
+	srv.sch.Start()
+	if seconds := int((gameTime + Countdown) / time.Second); seconds > 0 {
+		_, _ = srv.sch.Forward(seconds)
+	}
+	switch state {
+	case control.StatePaused:
+		_, _ = srv.sch.Pause()
+	case control.StateStopped:
+		_, _ = srv.sch.Stop()
+	}
+}
+
+// Fail makes the fake Server reject the command (e.g. "play") with the error, until it is called with a nil error.
+func (srv *Server) Fail(command string, err *control.CommandError) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if err == nil {
+		delete(srv.failures, command)
+		return
+	}
+	srv.failures[command] = err
+}
+
+// Notify streams the Notification to the watchers, e.g. an Event firing. Its state and game time are taken from
+// the Scheduler if they are not set.
+func (srv *Server) Notify(notification control.Notification) {
+	n := srv.sch.Snapshot()
+	n.Kind = string(notification.Kind)
+	if !notification.Time.IsZero() {
+		n.Time = notification.Time
+	}
+	if notification.State != "" {
+		n.State = string(notification.State)
+	}
+	if notification.GameClock != "" || notification.GameTime != 0 {
+		n.GameTime = int(notification.GameTime / time.Second)
+		n.GameClock = tools.SecondsToString(n.GameTime)
+	}
+	n.Event = notification.Event
+	n.SoundEffect = notification.SoundEffect
+	n.Occurrence = notification.Occurrence
+	n.Seconds = int(notification.Amount / time.Second)
+	srv.sch.Bus.Publish(n)
+}
+
+// serve accepts the connections until the listener is closed.
+func (srv *Server) serve() {
+	defer srv.wg.Done()
+	for {
+		conn, err := srv.lis.Accept()
+		if err != nil {
+			return
+		}
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			defer conn.Close()
+			srv.handle(conn)
+		}()
+	}
+}
+
+// handle records the Request of the connection, and answers it with the injected failure or passes the connection
+// on to the real Server.
+func (srv *Server) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+
+	var req model.Request
+	if err := json.Unmarshal(line, &req); err == nil {
+		srv.mu.Lock()
+		srv.requests = append(srv.requests, req)
+		failure, failing := srv.failures[req.Command]
+		srv.mu.Unlock()
+
+		if failing {
+			srv.fail(conn, req, failure)
+			return
+		}
+	}
+
+	upstream, err := net.Dial("tcp", srv.srv.Addr().String())
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	if _, err := upstream.Write(line); err != nil {
+		return
+	}
+
+	// a watch stream ends when the Client disconnects, the copy below ends when the real Server closes the connection
+	go func() {
+		_, _ = io.Copy(upstream, reader)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(conn, upstream)
+}
+
+// fail answers the Request with the error, and the state of the Scheduler as the real Server sends it.
+func (srv *Server) fail(conn net.Conn, req model.Request, failure *control.CommandError) {
+	res, err := client.NewClient(srv.srv.Addr().(*net.TCPAddr).Port).
+		WithHost("127.0.0.1").
+		Do(model.Request{Command: "status"})
+	if err != nil {
+		return
+	}
+
+	res.ID = req.ID
+	res.OK = false
+	res.Message = ""
+	res.Status = nil
+	res.Error = failure
+	data, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+	_, _ = conn.Write(append(data, '\n'))
+}
@@ -0,0 +1,29 @@
+package control
+
+import (
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// NotRunningError is returned if the Server cannot be reached, typically because it is not running.
+type NotRunningError = client.ConnectError
+
+// TimeoutError is returned if the Server does not respond in time.
+type TimeoutError = client.TimeoutError
+
+// CommandError is returned if the Server rejects a command, its Code tells why (e.g. CodeInvalidState if the
+// Scheduler is paused while it is stopped).
+type CommandError = model.ProtocolError
+
+// Codes of the CommandErrors
+const (
+	CodeBadRequest         = model.ErrorCodeBadRequest
+	CodeUnsupportedVersion = model.ErrorCodeUnsupportedVersion
+	CodeUnknownCommand     = model.ErrorCodeUnknownCommand
+	CodeInvalidArgument    = model.ErrorCodeInvalidArgument
+	CodeInvalidState       = model.ErrorCodeInvalidState
+	CodeSoundError         = model.ErrorCodeSoundError
+	CodeUnauthorized       = model.ErrorCodeUnauthorized
+	CodeBusy               = model.ErrorCodeBusy
+	CodeInternal           = model.ErrorCodeInternal
+)
@@ -0,0 +1,143 @@
+package control
+
+import (
+	"time"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// State is the state of the Scheduler.
+type State string
+
+// States of the Scheduler
+const (
+	StateStopped State = "stopped"
+	StateRunning State = "running"
+	StatePaused  State = "paused"
+)
+
+// Event is an upcoming occurrence of an Event of the profile.
+type Event struct {
+	Name        string
+	SoundEffect string
+	// GameTime is the time of the occurrence on the game clock
+	GameTime time.Duration
+	// GameClock is the game time as shown in the game, e.g. 00:03:00
+	GameClock string
+	// In is the time until the occurrence
+	In time.Duration
+}
+
+// ServerInfo describes the running Server: the profile it uses, where the profile comes from and how long it is up.
+type ServerInfo struct {
+	Profile    string
+	ConfigFile string
+	StartedAt  time.Time
+	Uptime     time.Duration
+}
+
+// Status is the state of the Scheduler after a command, with the upcoming events.
+type Status struct {
+	State State
+	// GameTime is the time on the game clock, negative during the countdown
+	GameTime time.Duration
+	// GameClock is the game time as shown in the game, e.g. -00:01:00
+	GameClock string
+	// Message is the message of the Server about the command, e.g. Scheduler started
+	Message    string
+	NextEvents []Event
+	// Server is only set by the Status method
+	Server *ServerInfo
+}
+
+// newStatus converts a Response of the Server into a Status.
+func newStatus(res model.Response) Status {
+	status := Status{
+		State:      State(res.State),
+		GameTime:   time.Duration(res.GameTime) * time.Second,
+		GameClock:  res.GameClock,
+		Message:    res.Message,
+		NextEvents: []Event{},
+	}
+	for _, event := range res.NextEvents {
+		status.NextEvents = append(status.NextEvents, Event{
+			Name:        event.Name,
+			SoundEffect: event.SoundEffect,
+			GameTime:    time.Duration(event.GameTime) * time.Second,
+			GameClock:   event.GameClock,
+			In:          time.Duration(event.In) * time.Second,
+		})
+	}
+	if res.Status != nil {
+		status.Server = &ServerInfo{
+			Profile:    res.Status.Profile,
+			ConfigFile: res.Status.ConfigFile,
+			StartedAt:  res.Status.StartedAt,
+			Uptime:     time.Duration(res.Status.Uptime) * time.Millisecond,
+		}
+	}
+	return status
+}
+
+// Kind is the kind of a Notification.
+type Kind string
+
+// Kinds of the Notifications
+const (
+	KindState         Kind = model.NotificationState
+	KindEvent         Kind = model.NotificationTimelineEvent
+	KindStarted       Kind = model.NotificationStarted
+	KindRestarted     Kind = model.NotificationRestarted
+	KindPaused        Kind = model.NotificationPaused
+	KindResumed       Kind = model.NotificationResumed
+	KindStopped       Kind = model.NotificationStopped
+	KindMatchEnded    Kind = model.NotificationMatchEnded
+	KindRolledBack    Kind = model.NotificationRolledBack
+	KindRolledForward Kind = model.NotificationRolledForward
+	KindTick          Kind = model.NotificationTick
+	KindCountdown     Kind = model.NotificationCountdown
+)
+
+// Notification is something that happened on the Server: an Event fired, the state changed, the match ended,
+// the Scheduler was rolled back or forward, a second passed on the game clock, or a countdown beep is due.
+type Notification struct {
+	Kind      Kind
+	Time      time.Time
+	State     State
+	GameTime  time.Duration
+	GameClock string
+	// Event, SoundEffect and Occurrence (the index of the occurrence of the Event, starting from 1) are only set
+	// for the Event and Countdown kinds
+	Event       string
+	SoundEffect string
+	Occurrence  int
+	// Amount is the amount of the RolledBack and RolledForward kinds, and the time until the Event for Countdown
+	Amount time.Duration
+}
+
+// newNotification converts a Notification of the Server.
+func newNotification(notification model.Notification) Notification {
+	return Notification{
+		Kind:        Kind(notification.Kind),
+		Time:        notification.Time,
+		State:       State(notification.State),
+		GameTime:    time.Duration(notification.GameTime) * time.Second,
+		GameClock:   notification.GameClock,
+		Event:       notification.Event,
+		SoundEffect: notification.SoundEffect,
+		Occurrence:  notification.Occurrence,
+		Amount:      time.Duration(notification.Seconds) * time.Second,
+	}
+}
+
+// String returns the Notification as a human readable line, e.g. [00:03:00] event: Bounty Runes.
+func (n Notification) String() string {
+	return model.Notification{
+		Kind:       string(n.Kind),
+		State:      string(n.State),
+		GameClock:  n.GameClock,
+		Event:      n.Event,
+		Occurrence: n.Occurrence,
+		Seconds:    int(n.Amount / time.Second),
+	}.String()
+}
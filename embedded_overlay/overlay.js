@@ -0,0 +1,99 @@
+// DotkaFX overlay: shows the game clock and the next events with live countdowns.
+// Query parameters: events (number of events, default 5), compact (1 or true), theme (dark, light, transparent).
+// It only talks to the DotkaFX Server serving this page, so it works fully offline.
+(function () {
+  "use strict";
+
+  var params = new URLSearchParams(window.location.search);
+  var eventCount = parseInt(params.get("events"), 10) || 5;
+  var compact = params.get("compact") === "1" || params.get("compact") === "true";
+  var theme = ["dark", "light", "transparent"].indexOf(params.get("theme")) >= 0 ? params.get("theme") : "dark";
+  // events closer than this (in seconds) are highlighted
+  var soonThreshold = 10;
+  // the length of the countdown bars (in seconds)
+  var barLength = 60;
+
+  document.body.classList.add(theme);
+  if (compact) {
+    document.body.classList.add("compact");
+  }
+
+  var clockElement = document.getElementById("clock");
+  var stateElement = document.getElementById("state");
+  var eventsElement = document.getElementById("events");
+
+  var gameTime = 0;
+  var upcoming = [];
+
+  function pad(n) {
+    return n < 10 ? "0" + n : "" + n;
+  }
+
+  // formatClock formats seconds like the game clock (e.g. 12:05 or -00:45)
+  function formatClock(seconds) {
+    var sign = seconds < 0 ? "-" : "";
+    seconds = Math.abs(seconds);
+    var hours = Math.floor(seconds / 3600);
+    var minutes = Math.floor(seconds / 60) % 60;
+    var rest = seconds % 60;
+    return sign + (hours > 0 ? hours + ":" + pad(minutes) : pad(minutes)) + ":" + pad(rest);
+  }
+
+  function render() {
+    clockElement.textContent = formatClock(gameTime);
+    eventsElement.textContent = "";
+    upcoming.filter(function (event) {
+      return event.gameTime >= gameTime;
+    }).slice(0, eventCount).forEach(function (event) {
+      var remaining = event.gameTime - gameTime;
+      var item = document.createElement("li");
+      if (remaining <= soonThreshold) {
+        item.className = "soon";
+      }
+      var name = document.createElement("span");
+      name.textContent = event.name;
+      var countdown = document.createElement("span");
+      countdown.className = "countdown";
+      countdown.textContent = formatClock(remaining);
+      var bar = document.createElement("span");
+      bar.className = "bar";
+      bar.style.width = Math.max(0, 100 - Math.min(remaining, barLength) / barLength * 100) + "%";
+      item.appendChild(name);
+      item.appendChild(countdown);
+      item.appendChild(bar);
+      eventsElement.appendChild(item);
+    });
+  }
+
+  function refreshEvents() {
+    // a few more events than shown, so the list stays full while the clock is ticking
+    fetch("/api/v1/events?n=" + (eventCount + 5)).then(function (response) {
+      return response.json();
+    }).then(function (events) {
+      upcoming = events || [];
+      render();
+    }).catch(function () {
+      stateElement.textContent = "offline";
+    });
+  }
+
+  function update(notification) {
+    gameTime = notification.gameTime;
+    stateElement.textContent = notification.state;
+    if (notification.kind === "tick") {
+      render();
+    } else {
+      refreshEvents();
+    }
+  }
+
+  var stream = new EventSource("/api/v1/stream");
+  ["state", "event", "started", "restarted", "paused", "resumed", "stopped", "ended", "back", "forward", "tick"].forEach(function (kind) {
+    stream.addEventListener(kind, function (message) {
+      update(JSON.parse(message.data));
+    });
+  });
+  stream.onerror = function () {
+    stateElement.textContent = "offline";
+  };
+})();
@@ -1,4 +1,4 @@
-module dotkafx
+module github.com/DonBattery/dotkafx
 
 go 1.19
 
@@ -6,6 +6,8 @@ require (
 	github.com/alexflint/go-arg v1.4.3
 	github.com/faiface/beep v1.1.0
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/sys v0.5.0
+	golang.org/x/term v0.0.0-20220722155259-a9ba230a4035
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -19,6 +21,5 @@ require (
 	golang.org/x/exp v0.0.0-20190306152737-a1d7652674e8 // indirect
 	golang.org/x/image v0.0.0-20190227222117-0694c2d4d067 // indirect
 	golang.org/x/mobile v0.0.0-20190415191353-3e0bab5405d6 // indirect
-	golang.org/x/sys v0.5.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
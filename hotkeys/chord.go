@@ -0,0 +1,158 @@
+package hotkeys
+
+import (
+	"fmt"
+	"strings"
+)
+
+// modifier is a modifier key of a chord with its names in the hotkey tools.
+type modifier struct {
+	name     string
+	ahk      string
+	xbindkey string
+	sxhkd    string
+}
+
+// modifiers are the modifier keys in the order they are written
+var modifiers = []modifier{
+	{"Ctrl", "^", "Control", "ctrl"},
+	{"Alt", "!", "Mod1", "alt"},
+	{"Shift", "+", "Shift", "shift"},
+	{"Win", "#", "Mod4", "super"},
+}
+
+// modifierAliases maps the lower case names of the modifiers to their index in modifiers
+var modifierAliases = map[string]int{
+	"ctrl": 0, "control": 0,
+	"alt":   1,
+	"shift": 2,
+	"win":   3, "super": 3,
+}
+
+// key is a key of a chord with its names in AutoHotkey and in X11 (xbindkeys and sxhkd use the keysyms).
+type key struct {
+	name string
+	ahk  string
+	x11  string
+}
+
+// keys maps the lower case names of the keys (and their aliases) to the keys
+var keys = map[string]key{
+	"space":      {"Space", "Space", "space"},
+	"enter":      {"Enter", "Enter", "Return"},
+	"tab":        {"Tab", "Tab", "Tab"},
+	"escape":     {"Escape", "Escape", "Escape"},
+	"esc":        {"Escape", "Escape", "Escape"},
+	"backspace":  {"Backspace", "Backspace", "BackSpace"},
+	"insert":     {"Insert", "Insert", "Insert"},
+	"delete":     {"Delete", "Delete", "Delete"},
+	"home":       {"Home", "Home", "Home"},
+	"end":        {"End", "End", "End"},
+	"pgup":       {"PgUp", "PgUp", "Prior"},
+	"pageup":     {"PgUp", "PgUp", "Prior"},
+	"pgdn":       {"PgDn", "PgDn", "Next"},
+	"pagedown":   {"PgDn", "PgDn", "Next"},
+	"up":         {"Up", "Up", "Up"},
+	"down":       {"Down", "Down", "Down"},
+	"left":       {"Left", "Left", "Left"},
+	"right":      {"Right", "Right", "Right"},
+	"pause":      {"Pause", "Pause", "Pause"},
+	"scrolllock": {"ScrollLock", "ScrollLock", "Scroll_Lock"},
+}
+
+func init() {
+	for i := 1; i <= 24; i++ {
+		name := fmt.Sprintf("F%d", i)
+		keys[strings.ToLower(name)] = key{name, name, name}
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		keys[string(c)] = key{strings.ToUpper(string(c)), string(c), string(c)}
+	}
+	for c := '0'; c <= '9'; c++ {
+		keys[string(c)] = key{string(c), string(c), string(c)}
+		keys["numpad"+string(c)] = key{"Numpad" + string(c), "Numpad" + string(c), "KP_" + string(c)}
+	}
+}
+
+// Chord is a key pressed together with modifier keys, e.g. Ctrl+Shift+F2.
+type Chord struct {
+	// modifiers tells which of the modifiers are pressed
+	modifiers [4]bool
+	key       key
+}
+
+// ParseChord parses a chord written as modifiers and a key separated by + signs (e.g. Ctrl+F2 or alt+shift+b).
+// The names are case-insensitive.
+func ParseChord(text string) (Chord, error) {
+	chord := Chord{}
+	parts := strings.Split(text, "+")
+	for i, part := range parts {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" {
+			return chord, fmt.Errorf("The chord %s has an empty key", text)
+		}
+
+		if i < len(parts)-1 {
+			index, ok := modifierAliases[name]
+			if !ok {
+				return chord, fmt.Errorf("Unknown modifier %s in the chord %s, it has to be Ctrl, Alt, Shift or Win", part, text)
+			}
+			if chord.modifiers[index] {
+				return chord, fmt.Errorf("The modifier %s is repeated in the chord %s", part, text)
+			}
+			chord.modifiers[index] = true
+			continue
+		}
+
+		k, ok := keys[name]
+		if !ok {
+			return chord, fmt.Errorf("Unknown key %s in the chord %s", part, text)
+		}
+		chord.key = k
+	}
+	return chord, nil
+}
+
+// String returns the chord in its canonical form, e.g. Ctrl+Shift+F2.
+func (c Chord) String() string {
+	names := []string{}
+	for i, mod := range modifiers {
+		if c.modifiers[i] {
+			names = append(names, mod.name)
+		}
+	}
+	return strings.Join(append(names, c.key.name), "+")
+}
+
+// ahk returns the chord in the hotkey syntax of AutoHotkey, e.g. ^+F2.
+func (c Chord) ahk() string {
+	text := ""
+	for i, mod := range modifiers {
+		if c.modifiers[i] {
+			text += mod.ahk
+		}
+	}
+	return text + c.key.ahk
+}
+
+// xbindkeys returns the chord in the syntax of xbindkeys, e.g. Control + Shift + F2.
+func (c Chord) xbindkeys() string {
+	names := []string{}
+	for i, mod := range modifiers {
+		if c.modifiers[i] {
+			names = append(names, mod.xbindkey)
+		}
+	}
+	return strings.Join(append(names, c.key.x11), " + ")
+}
+
+// sxhkd returns the chord in the syntax of sxhkd, e.g. ctrl + shift + F2.
+func (c Chord) sxhkd() string {
+	names := []string{}
+	for i, mod := range modifiers {
+		if c.modifiers[i] {
+			names = append(names, mod.sxhkd)
+		}
+	}
+	return strings.Join(append(names, c.key.x11), " + ")
+}
@@ -0,0 +1,156 @@
+package hotkeys
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// ServerCommand is the command of a hotkey which spins up the Server, it runs the program without a command
+const ServerCommand = "server"
+
+// Formats of the binding files
+const (
+	FormatAHK       = "ahk"
+	FormatXbindkeys = "xbindkeys"
+	FormatSxhkd     = "sxhkd"
+)
+
+// Binding is a validated Hotkey: the chord and the command line it runs.
+type Binding struct {
+	Chord   Chord
+	Command string
+}
+
+// Validate parses the chords of the Hotkeys and checks their commands with the validate function (the commands
+// of the application). A chord bound twice (also if written differently, e.g. ctrl+f2 and Ctrl+F2) is rejected.
+func Validate(hotkeys []model.Hotkey, validate func(line string) error) ([]Binding, error) {
+	bindings := []Binding{}
+	bound := map[string]Binding{}
+	for _, hotkey := range hotkeys {
+		chord, err := ParseChord(hotkey.Chord)
+		if err != nil {
+			return nil, err
+		}
+
+		command := strings.Join(strings.Fields(hotkey.Command), " ")
+		if command == "" {
+			return nil, fmt.Errorf("The hotkey %s has no command", chord)
+		}
+		if command != ServerCommand {
+			if err := validate(command); err != nil {
+				// the message of the Server is meant for the user, without its error code
+				var protoErr *model.ProtocolError
+				if errors.As(err, &protoErr) {
+					err = errors.New(protoErr.Message)
+				}
+				return nil, fmt.Errorf("The hotkey %s has an invalid command %s: %s", chord, command, err)
+			}
+		}
+
+		if other, ok := bound[chord.String()]; ok {
+			return nil, fmt.Errorf("The chord %s is bound twice, to %s and to %s", chord, other.Command, command)
+		}
+		binding := Binding{Chord: chord, Command: command}
+		bound[chord.String()] = binding
+		bindings = append(bindings, binding)
+	}
+	return bindings, nil
+}
+
+// Export writes the binding file of the hotkey tool in the format (ahk, xbindkeys or sxhkd). The bindings run
+// the program with their command lines.
+func Export(w io.Writer, format string, program string, bindings []Binding) error {
+	var file string
+	switch format {
+	case FormatAHK:
+		file = ahk(program, bindings)
+	case FormatXbindkeys:
+		file = xbindkeys(program, bindings)
+	case FormatSxhkd:
+		file = sxhkd(program, bindings)
+	default:
+		return fmt.Errorf("Unknown hotkey format %s, it has to be %s, %s or %s", format, FormatAHK, FormatXbindkeys, FormatSxhkd)
+	}
+	_, err := io.WriteString(w, file)
+	return err
+}
+
+// commandLine returns the program with the command line of the binding, nothing is added to the program for the
+// ServerCommand.
+func commandLine(program string, binding Binding, quote func(word string) string) string {
+	words := []string{quote(program)}
+	if binding.Command != ServerCommand {
+		for _, word := range strings.Fields(binding.Command) {
+			words = append(words, quote(word))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// description returns the comment of a binding.
+func description(binding Binding) string {
+	if binding.Command == ServerCommand {
+		return fmt.Sprintf("spin up the DotkaFX Server when %s is pressed", binding.Chord)
+	}
+	return fmt.Sprintf("%s when %s is pressed", binding.Command, binding.Chord)
+}
+
+// ahk returns the AutoHotkey (v1) script of the bindings. The commands run minimized, except the Server.
+func ahk(program string, bindings []Binding) string {
+	var b strings.Builder
+	b.WriteString("; DotkaFX hotkeys, generated by: dotkafx hotkeys export --format ahk\n")
+	for _, binding := range bindings {
+		run := "Run, " + commandLine(program, binding, ahkEscape)
+		if binding.Command != ServerCommand {
+			run += ",, Min"
+		}
+		fmt.Fprintf(&b, "\n; %s\n%s::\n%s\nreturn\n", description(binding), binding.Chord.ahk(), run)
+	}
+	return b.String()
+}
+
+// ahkEscape escapes the characters which have a meaning in the parameters of an AutoHotkey command.
+func ahkEscape(word string) string {
+	return strings.NewReplacer("`", "``", "%", "`%", ",", "`,", ";", "`;").Replace(word)
+}
+
+// xbindkeys returns the .xbindkeysrc file of the bindings.
+func xbindkeys(program string, bindings []Binding) string {
+	var b strings.Builder
+	b.WriteString("# DotkaFX hotkeys, generated by: dotkafx hotkeys export --format xbindkeys\n")
+	for _, binding := range bindings {
+		command := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(commandLine(program, binding, shellQuote))
+		if binding.Command == ServerCommand {
+			// the Server keeps running, so it is sent to the background
+			command += " &"
+		}
+		fmt.Fprintf(&b, "\n# %s\n\"%s\"\n    %s\n", description(binding), command, binding.Chord.xbindkeys())
+	}
+	return b.String()
+}
+
+// sxhkd returns the sxhkdrc file of the bindings.
+func sxhkd(program string, bindings []Binding) string {
+	var b strings.Builder
+	b.WriteString("# DotkaFX hotkeys, generated by: dotkafx hotkeys export --format sxhkd\n")
+	for _, binding := range bindings {
+		fmt.Fprintf(&b, "\n# %s\n%s\n    %s\n", description(binding), binding.Chord.sxhkd(), commandLine(program, binding, shellQuote))
+	}
+	return b.String()
+}
+
+// plainWord matches the words which need no quotes in a shell
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9_./:=@+-]+$`)
+
+// shellQuote quotes the word for a POSIX shell if it is needed (e.g. an event name like Aghanim's Shard).
+func shellQuote(word string) string {
+	if plainWord.MatchString(word) {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
@@ -0,0 +1,179 @@
+package hotkeys_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/config"
+	"github.com/DonBattery/dotkafx/hotkeys"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/server"
+)
+
+// parseCommand validates the commands with the parser of the Server
+func parseCommand(line string) error {
+	_, err := server.ParseCommand(line)
+	return err
+}
+
+func TestParseChord(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		text          string
+		requiredChord string
+		requiredError string
+	}{
+		"functionKey":       {"Ctrl+F2", "Ctrl+F2", ""},
+		"caseInsensitive":   {"ctrl+shift+b", "Ctrl+Shift+B", ""},
+		"modifierOrder":     {"Win + Shift + Alt + Control + PageUp", "Ctrl+Alt+Shift+Win+PgUp", ""},
+		"noModifier":        {"Numpad5", "Numpad5", ""},
+		"unknownKey":        {"Ctrl+F25", "", "Unknown key F25 in the chord Ctrl+F25"},
+		"unknownModifier":   {"Hyper+F1", "", "Unknown modifier Hyper in the chord Hyper+F1, it has to be Ctrl, Alt, Shift or Win"},
+		"repeatedModifier":  {"Ctrl+Control+F1", "", "The modifier Control is repeated in the chord Ctrl+Control+F1"},
+		"modifierWithNoKey": {"Ctrl+", "", "The chord Ctrl+ has an empty key"},
+		"empty":             {"", "", "The chord  has an empty key"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing parse chord, with %s", testCaseName)
+
+		chord, err := hotkeys.ParseChord(testCase.text)
+		if testCase.requiredError != "" {
+			require.EqualError(err, testCase.requiredError, testCaseName)
+			continue
+		}
+		require.NoError(err, testCaseName)
+		require.Equal(testCase.requiredChord, chord.String(), testCaseName)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		hotkeys          []model.Hotkey
+		requiredCommands []string
+		requiredError    string
+	}{
+		"valid": {[]model.Hotkey{
+			{Chord: "Ctrl+F1", Command: "server"},
+			{Chord: "Ctrl+F3", Command: "back5"},
+			{Chord: "Ctrl+F4", Command: " forward  30 "},
+			{Chord: "Alt+P", Command: "preview Bounty Runes"},
+		}, []string{"server", "back5", "forward 30", "preview Bounty Runes"}, ""},
+		"unknownCommand": {[]model.Hotkey{
+			{Chord: "Ctrl+F1", Command: "jump"},
+		}, nil, "The hotkey Ctrl+F1 has an invalid command jump: Unknown command: jump"},
+		"invalidArgument": {[]model.Hotkey{
+			{Chord: "Ctrl+F1", Command: "back five"},
+		}, nil, "The hotkey Ctrl+F1 has an invalid command back five: Invalid value for [seconds]"},
+		"noCommand": {[]model.Hotkey{
+			{Chord: "Ctrl+F1"},
+		}, nil, "The hotkey Ctrl+F1 has no command"},
+		"duplicateChord": {[]model.Hotkey{
+			{Chord: "Ctrl+F2", Command: "start"},
+			{Chord: "control + f2", Command: "pause"},
+		}, nil, "The chord Ctrl+F2 is bound twice, to start and to pause"},
+		"invalidChord": {[]model.Hotkey{
+			{Chord: "Ctrl+Mouse1", Command: "start"},
+		}, nil, "Unknown key Mouse1 in the chord Ctrl+Mouse1"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing validate, with %s", testCaseName)
+
+		bindings, err := hotkeys.Validate(testCase.hotkeys, parseCommand)
+		if testCase.requiredError != "" {
+			require.Error(err, testCaseName)
+			require.True(strings.HasPrefix(err.Error(), testCase.requiredError), "%s: %s", testCaseName, err)
+			continue
+		}
+		require.NoError(err, testCaseName)
+		commands := []string{}
+		for _, binding := range bindings {
+			commands = append(commands, binding.Command)
+		}
+		require.Equal(testCase.requiredCommands, commands, testCaseName)
+	}
+}
+
+func TestExport(t *testing.T) {
+	require := assert.New(t)
+
+	bindings, err := hotkeys.Validate([]model.Hotkey{
+		{Chord: "Ctrl+Shift+F1", Command: "server"},
+		{Chord: "Alt+Win+PgDn", Command: "preview Aghanim's Shard"},
+	}, parseCommand)
+	require.NoError(err)
+
+	testCases := map[string]struct {
+		format       string
+		requiredFile string
+	}{
+		"ahk": {hotkeys.FormatAHK, `; DotkaFX hotkeys, generated by: dotkafx hotkeys export --format ahk
+
+; spin up the DotkaFX Server when Ctrl+Shift+F1 is pressed
+^+F1::
+Run, dotkafx
+return
+
+; preview Aghanim's Shard when Alt+Win+PgDn is pressed
+!#PgDn::
+Run, dotkafx preview Aghanim's Shard,, Min
+return
+`},
+		"xbindkeys": {hotkeys.FormatXbindkeys, `# DotkaFX hotkeys, generated by: dotkafx hotkeys export --format xbindkeys
+
+# spin up the DotkaFX Server when Ctrl+Shift+F1 is pressed
+"dotkafx &"
+    Control + Shift + F1
+
+# preview Aghanim's Shard when Alt+Win+PgDn is pressed
+"dotkafx preview 'Aghanim'\\''s' Shard"
+    Mod1 + Mod4 + Next
+`},
+		"sxhkd": {hotkeys.FormatSxhkd, `# DotkaFX hotkeys, generated by: dotkafx hotkeys export --format sxhkd
+
+# spin up the DotkaFX Server when Ctrl+Shift+F1 is pressed
+ctrl + shift + F1
+    dotkafx
+
+# preview Aghanim's Shard when Alt+Win+PgDn is pressed
+alt + super + Next
+    dotkafx preview 'Aghanim'\''s' Shard
+`},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing export, with %s", testCaseName)
+
+		var file strings.Builder
+		require.NoError(hotkeys.Export(&file, testCase.format, "dotkafx", bindings), testCaseName)
+		require.Equal(testCase.requiredFile, file.String(), testCaseName)
+	}
+
+	err = hotkeys.Export(&strings.Builder{}, "karabiner", "dotkafx", bindings)
+	require.EqualError(err, "Unknown hotkey format karabiner, it has to be ahk, xbindkeys or sxhkd")
+}
+
+// TestDefaultHotkeys checks that the AutoHotkey script of the repository is generated from the default config.
+func TestDefaultHotkeys(t *testing.T) {
+	require := assert.New(t)
+
+	data, err := os.ReadFile("../dotkafx_config.yml")
+	require.NoError(err)
+	conf, err := config.CreateConfig(data)
+	require.NoError(err)
+	bindings, err := hotkeys.Validate(conf.Hotkeys, parseCommand)
+	require.NoError(err)
+
+	script, err := os.ReadFile("../dotkafx.ahk")
+	require.NoError(err)
+	var file strings.Builder
+	require.NoError(hotkeys.Export(&file, hotkeys.FormatAHK, "dotkafx", bindings))
+	require.Equal(string(script), file.String(), "regenerate dotkafx.ahk with: dotkafx hotkeys export > dotkafx.ahk")
+}
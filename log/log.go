@@ -52,10 +52,6 @@ func Entry(level LogLevel, format string, args ...any) {
 	if level == FatalLevel {
 		os.Exit(1)
 	}
-
-	if level == ShutdownLevel {
-		os.Exit(0)
-	}
 }
 
 func Debug(format string, args ...any) {
@@ -78,6 +74,8 @@ func Fatal(format string, args ...any) {
 	Entry(FatalLevel, format, args...)
 }
 
+// Shutdown logs the last message of a gracefully stopping application. Unlike Fatal it does not exit,
+// the application is expected to return from main.
 func Shutdown(format string, args ...any) {
 	Entry(ShutdownLevel, format, args...)
 }
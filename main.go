@@ -1,19 +1,30 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/alexflint/go-arg"
 
-	"dotkafx/client"
-	"dotkafx/config"
-	"dotkafx/log"
-	"dotkafx/model"
-	"dotkafx/scheduler"
-	"dotkafx/server"
-	"dotkafx/sound"
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/completion"
+	"github.com/DonBattery/dotkafx/config"
+	"github.com/DonBattery/dotkafx/hotkeys"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/render"
+	"github.com/DonBattery/dotkafx/repl"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+	"github.com/DonBattery/dotkafx/tools"
+	"github.com/DonBattery/dotkafx/tui"
 )
 
 var (
@@ -22,6 +33,9 @@ var (
 
 	//go:embed embedded_sounds/*.mp3
 	embeddedSounds embed.FS
+
+	//go:embed embedded_overlay
+	embeddedOverlay embed.FS
 )
 
 func main() {
@@ -33,24 +47,90 @@ func main() {
 		log.LoggingLevel = log.DebugLevel
 	}
 
-	log.Debug("Running with command: %+v", command)
+	if command.LockFile == "" {
+		command.LockFile = config.DefaultLockFile()
+	}
+
+	log.Debug("Running with command: %+v", command.Redacted())
+
+	// the render command is executed locally, without a running Server
+	if command.Line() == "render" {
+		runRender(command)
+		return
+	}
+
+	// the hotkeys command reads the config, so it works without a running Server
+	if len(command.Command) > 0 && command.Command[0] == "hotkeys" {
+		runHotkeys(command)
+		return
+	}
+
+	// the completion command reads the config, so it works without a running Server
+	if len(command.Command) > 0 && command.Command[0] == "completion" {
+		runCompletion(command)
+		return
+	}
 
 	// if there is a positional argument, run the Client and pass the argument to it as the command.
 	if len(command.Command) > 0 {
-		log.Debug("Sending message: %s to DotkaFX Server via TCP Port: %d", command.Command, command.Port)
-		response, err := client.NewClient(command.Port).SendRequest(command.Command)
-		if err != nil {
-			quit(err)
-		}
-		log.Info(response)
+		runClient(command)
 	} else {
 		runServer(command)
 	}
 }
 
-func runServer(cmd model.RootCommand) {
-	// get the configuration
-	confData, err := config.GetConfigData(defaultConfig)
+// runClient sends the command to the Server, starting the Server first if it is not running and --spawn is set.
+func runClient(command model.RootCommand) {
+	cli := client.NewClient(command.Port).
+		WithHost(command.Host).
+		WithToken(command.Token).
+		WithTimeouts(command.ConnectTimeout, command.ResponseTimeout).
+		WithRetries(command.Retries, client.DefaultRetryBackoff).
+		WithLockFile(command.LockFile)
+	if command.Socket != "" {
+		cli.WithSocket(command.Socket)
+	}
+	log.Debug("Sending message: %s to DotkaFX Server on %s", command.Line(), cli.Address())
+
+	if command.Spawn {
+		if err := ensureServer(cli, command); err != nil {
+			fail(command.Output, model.Response{}, err)
+		}
+	}
+
+	// the session command is used by the REPL and the dashboard, its connection would wait for more requests
+	if len(command.Command) > 0 && strings.EqualFold(command.Command[0], "session") {
+		fail(command.Output, model.Response{}, errors.New("The session command is only used internally, run dotkafx repl for an interactive session"))
+	}
+
+	// the watch command keeps the connection open, so its stream is rendered as it comes
+	if line := strings.ToLower(command.Line()); line == "watch" || line == "watch ticks" {
+		runWatch(cli, line == "watch ticks", command.Output)
+		return
+	}
+
+	// the REPL and the dashboard keep their connections open until the user leaves them
+	switch strings.ToLower(command.Line()) {
+	case "repl":
+		runREPL(cli)
+		return
+	case "tui":
+		if err := tui.Run(context.Background(), cli, os.Stdin, os.Stdout); err != nil {
+			quit(err)
+		}
+		return
+	}
+
+	res, err := cli.Do(model.Request{Line: command.Line()})
+	if err != nil {
+		fail(command.Output, res, err)
+	}
+	printResponse(os.Stdout, command.Output, res)
+}
+
+// loadConfig reads the configuration.
+func loadConfig() model.Config {
+	confData, confFile, err := config.GetConfigData(defaultConfig)
 	if err != nil {
 		quit(err)
 	}
@@ -58,7 +138,15 @@ func runServer(cmd model.RootCommand) {
 	if err != nil {
 		quit(err)
 	}
+	conf.File = confFile
 	log.Debug("Config object:\n%s", conf)
+
+	return conf
+}
+
+// loadProfile reads the configuration and returns the Profile selected by the command.
+func loadProfile(cmd model.RootCommand) model.ConfigProfile {
+	conf := loadConfig()
 	log.Debug("Config Profile: %s", cmd.ConfigProfileName)
 	profile, err := conf.CreateAndValidateProfile(cmd.ConfigProfileName)
 	if err != nil {
@@ -66,24 +154,267 @@ func runServer(cmd model.RootCommand) {
 	}
 	log.Debug("Loaded SoundEffects: %+v", profile.AllSoundEffect())
 
+	return profile
+}
+
+func runServer(cmd model.RootCommand) {
+	if cmd.Port == 0 {
+		cmd.Port = model.DefaultPort
+	}
+
+	// get the configuration
+	profile := loadProfile(cmd)
+
 	// create the Sound Effect Player
-	fx := sound.NewPlayer(embeddedSounds)
+	fx := sound.NewPlayer(embeddedSounds, profile.SoundPacks)
 	if err := fx.LoadSoundsAndInitSpeaker(profile); err != nil {
 		quit(err)
 	}
+	defer fx.CloseSpeaker()
 
 	// create the Scheduler
-	sch := scheduler.NewScheduler(profile)
+	sch := scheduler.NewScheduler(profile, fx.Durations())
 	log.Debug("Scheduler Timeline:\n%s", sch.TimelineString())
 
-	// create and run the Server
-	srv := server.NewServer(fx, sch, cmd)
-	quit(srv.Run())
+	// create and run the Server until it is shut down by a command or an OS signal
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := server.NewServer(fx, sch, cmd, embeddedOverlay)
+	if err := srv.Run(ctx); err != nil {
+		quit(err)
+	}
+}
+
+// runRender mixes the timeline of the Profile into a WAV file and prints the index of the rendered clips.
+func runRender(cmd model.RootCommand) {
+	profile := loadProfile(cmd)
+
+	opts := render.Options{
+		From:     -profile.Countdown,
+		To:       profile.MatchLength,
+		Compress: cmd.Compress,
+	}
+	if cmd.From != "" {
+		from, err := tools.ClockToSeconds(cmd.From)
+		if err != nil {
+			quit(err)
+		}
+		opts.From = from
+	}
+	if cmd.To != "" {
+		to, err := tools.ClockToSeconds(cmd.To)
+		if err != nil {
+			quit(err)
+		}
+		opts.To = to
+	}
+
+	fx := sound.NewPlayer(embeddedSounds, profile.SoundPacks)
+	if err := fx.LoadSounds(profile); err != nil {
+		quit(err)
+	}
+
+	sch := scheduler.NewScheduler(profile, fx.Durations())
+
+	index, err := render.RenderFile(cmd.RenderFile, fx, sch.Timeline(), opts)
+	if err != nil {
+		quit(err)
+	}
+
+	log.Info("Timeline rendered into %s", cmd.RenderFile)
+	for _, entry := range index {
+		log.Info(entry.String())
+	}
+}
+
+// localCommands are the commands executed by the application itself, besides the commands of the Server
+var localCommands = []model.CommandInfo{
+	{Name: "render", Usage: "render", Help: "mix the timeline of the profile into a WAV file"},
+	{Name: "repl", Usage: "repl", Help: "send commands to the Server interactively"},
+	{Name: "tui", Usage: "tui", Help: "show the dashboard of the Server"},
+	{Name: "hotkeys", Usage: "hotkeys export", Help: "print the binding file of the Hotkeys of the config", Args: []model.ArgumentInfo{
+		{Name: "export", Kind: "switch", Help: "print the binding file in the --format"},
+	}},
+	{Name: "completion", Usage: "completion <shell>", Help: "print the completion script of a shell", Args: []model.ArgumentInfo{
+		{Name: "shell", Kind: "name", Help: "bash, zsh or fish, or profiles, events or sounds for the names the scripts complete"},
+	}},
+}
+
+// runCompletion prints the completion script of a shell, or the names the scripts complete: the profiles of the
+// config, or the events or the sounds of the profile. The names are read from the config, without a running Server.
+func runCompletion(cmd model.RootCommand) {
+	if len(cmd.Command) != 2 {
+		quit(errors.New("The completion command needs one argument: bash, zsh, fish, profiles, events or sounds"))
+	}
+
+	switch what := cmd.Command[1]; what {
+	case completion.SourceProfiles, completion.SourceEvents, completion.SourceSounds:
+		// the output is read by the shell, so the errors only show in the exit code
+		conf, err := config.ReadConfig(defaultConfig)
+		if err != nil {
+			os.Exit(exitError)
+		}
+		names, err := completion.Names(conf, cmd.ConfigProfileName, what)
+		if err != nil {
+			os.Exit(exitError)
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	default:
+		spec := completion.Spec{
+			Program:  "dotkafx",
+			Flags:    completion.Flags(model.RootCommand{}),
+			Commands: append(server.Commands(), localCommands...),
+		}
+		if err := completion.Generate(os.Stdout, what, spec); err != nil {
+			quit(err)
+		}
+	}
+}
+
+// runHotkeys prints the binding file of the Hotkeys of the config, in the format of a hotkey tool.
+func runHotkeys(cmd model.RootCommand) {
+	if cmd.Line() != "hotkeys export" {
+		quit(errors.New("The hotkeys command needs the export argument, e.g. hotkeys export --format ahk"))
+	}
+
+	conf := loadConfig()
+	if len(conf.Hotkeys) == 0 {
+		quit(fmt.Errorf("There are no Hotkeys in the config %s", conf.File))
+	}
+	bindings, err := hotkeys.Validate(conf.Hotkeys, validateCommand)
+	if err != nil {
+		quit(err)
+	}
+	if err := hotkeys.Export(os.Stdout, cmd.Format, "dotkafx", bindings); err != nil {
+		quit(err)
+	}
+}
+
+// streamCommands keep the connection open until the Server shuts down, so a hotkey cannot run them
+var streamCommands = map[string]bool{"watch": true, "session": true}
+
+// interactiveCommands take over the terminal they are started in, a hotkey has none
+var interactiveCommands = map[string]bool{"repl": true, "tui": true}
+
+// validateCommand checks a command line the way the application runs it from a hotkey: as a local command, or as
+// a command of the Server. The commands which never end without the user are refused.
+func validateCommand(line string) error {
+	name, _, _ := strings.Cut(line, " ")
+	if streamCommands[strings.ToLower(name)] {
+		return fmt.Errorf("The %s command keeps running until the Server shuts down", strings.ToLower(name))
+	}
+	if interactiveCommands[name] {
+		return fmt.Errorf("The %s command is interactive, it needs a terminal", name)
+	}
+
+	for _, local := range localCommands {
+		if local.Name != name {
+			continue
+		}
+		valid := line == name
+		switch name {
+		case "hotkeys":
+			valid = line == "hotkeys export"
+		case "completion":
+			valid = len(strings.Fields(line)) == 2
+		}
+		if !valid {
+			return fmt.Errorf("Usage: %s", local.Usage)
+		}
+		return nil
+	}
+
+	_, err := server.ParseCommand(line)
+	return err
+}
+
+// runWatch prints the Notifications of the Server until it shuts down or the user interrupts the Client.
+// On a terminal the ticks of the game clock overwrite each other, so only the events scroll. In the JSON format
+// every Notification is printed as a line of JSON.
+func runWatch(cli *client.Client, ticks bool, format model.OutputFormat) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	terminal := false
+	if info, err := os.Stdout.Stat(); err == nil && format == model.OutputText {
+		terminal = info.Mode()&os.ModeCharDevice != 0
+	}
+
+	// overwriting tells whether the last printed line is a tick which is overwritten by the next line
+	overwriting := false
+	err := cli.Watch(ctx, ticks, func(notification model.Notification) {
+		if format == model.OutputJSON {
+			printJSON(os.Stdout, notification)
+			return
+		}
+		if terminal && overwriting {
+			fmt.Print("\r\033[K")
+		}
+		overwriting = terminal && notification.Kind == model.NotificationTick
+		if overwriting {
+			fmt.Print(notification)
+			return
+		}
+		fmt.Printf("%s %s\n", notification.Time.Local().Format("15:04:05"), notification)
+	})
+	if overwriting {
+		fmt.Println()
+	}
+	if err != nil {
+		fail(format, model.Response{}, err)
+	}
+	if format == model.OutputText {
+		log.Info("The stream of the DotkaFX Server has ended")
+	}
+}
+
+// runREPL runs the interactive client until the user leaves it or the Server shuts down.
+func runREPL(cli *client.Client) {
+	r, err := repl.New(cli)
+	if err != nil {
+		quit(err)
+	}
+	fmt.Println("DotkaFX REPL, enter help for the commands, exit or Ctrl+D to leave")
+	if err := r.Run(context.Background(), os.Stdin, os.Stdout); err != nil {
+		quit(err)
+	}
+}
+
+// Exit codes of the application, so scripts can tell why a command failed
+const (
+	exitError            = 1
+	exitServerNotRunning = 2
+	exitCommandRejected  = 3
+)
+
+// exitCode returns the exit code of the error: the Server is not running, the Server rejected the command,
+// or anything else.
+func exitCode(err error) int {
+	var (
+		connectErr *client.ConnectError
+		protoErr   *model.ProtocolError
+	)
+	switch {
+	case errors.As(err, &connectErr):
+		return exitServerNotRunning
+	case errors.As(err, &protoErr):
+		return exitCommandRejected
+	default:
+		return exitError
+	}
 }
 
-func quit(errorMessage any) {
-	if errorMessage != nil {
-		log.Fatal(fmt.Sprintf("%s", errorMessage))
+// quit logs the error and exits the application with a non-zero exit code telling the kind of the error.
+func quit(err error) {
+	var protoErr *model.ProtocolError
+	if errors.As(err, &protoErr) {
+		// the message of the Server is meant for the user, the code is in the exit code
+		log.Error(protoErr.Message)
+	} else {
+		log.Error("%s", err)
 	}
-	os.Exit(0)
+	os.Exit(exitCode(err))
 }
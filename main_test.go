@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+// startServer serves a Server of a test profile, which plays no sounds, on a random loopback port until the
+// test ends, and returns its port.
+func startServer(t *testing.T) int {
+	profile := model.ConfigProfile{
+		Name:        "test",
+		Countdown:   60,
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			"Bounty Runes": {FirstHappensAt: 180, Interval: 180, SoundEffect: "bounty_runes_appeared"},
+		},
+	}
+	cmd := model.RootCommand{Listen: "127.0.0.1"}
+	srv := server.NewServer(sound.NewPlayer(embed.FS{}, nil), scheduler.NewScheduler(profile, nil), cmd, embed.FS{})
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return srv.Addr().(*net.TCPAddr).Port
+}
+
+// silentServer accepts connections on a random loopback port, and never answers them. The connections are
+// held until the test ends.
+func silentServer(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		close(done)
+		_ = lis.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				<-done
+			}()
+		}
+	}()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) int {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+// newClient creates a Client of the port on the loopback address, which does not retry.
+func newClient(port int) *client.Client {
+	return client.NewClient(port).
+		WithHost("127.0.0.1").
+		WithTimeouts(time.Second, time.Second).
+		WithRetries(0, 0)
+}
+
+func TestExitCode(t *testing.T) {
+	require := assert.New(t)
+
+	port := startServer(t)
+
+	testCases := map[string]struct {
+		port         int
+		line         string
+		requiredCode int
+	}{
+		"notRunning": {freePort(t), "start", exitServerNotRunning},
+		"rejected":   {port, "stop", exitCommandRejected},
+		"unknown":    {port, "dance", exitCommandRejected},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing exitCode, with %s", testCaseName)
+
+		_, err := newClient(testCase.port).Do(model.Request{Line: testCase.line})
+		require.Error(err, testCaseName)
+		require.Equal(testCase.requiredCode, exitCode(err), testCaseName)
+	}
+
+	require.Equal(exitError, exitCode(errors.New("The config is invalid")))
+}
+
+func TestServerArgs(t *testing.T) {
+	require := assert.New(t)
+
+	cmd := model.RootCommand{
+		ConfigProfileName: "turbo",
+		Port:              40000,
+		LockFile:          "/tmp/dotkafx.lock",
+		Listen:            "127.0.0.1",
+		MaxConnections:    8,
+		ReadTimeout:       5 * time.Second,
+	}
+
+	testCases := map[string]struct {
+		change       func(cmd *model.RootCommand)
+		requiredArgs []string
+	}{
+		"tcp": {func(cmd *model.RootCommand) {}, nil},
+		"socket": {func(cmd *model.RootCommand) {
+			cmd.Socket = "/tmp/dotkafx.sock"
+			cmd.NoTCP = true
+		}, []string{"--socket", "/tmp/dotkafx.sock", "--no-tcp"}},
+		"httpAndDebug": {func(cmd *model.RootCommand) {
+			cmd.HTTPPort = 40001
+			cmd.Debug = true
+			// the token is passed in the environment
+			cmd.Token = "secret"
+		}, []string{"--http-port", "40001", "--debug"}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing serverArgs, with %s", testCaseName)
+
+		changed := cmd
+		testCase.change(&changed)
+		required := append([]string{
+			"--config-profile-name", "turbo",
+			"--port", "40000",
+			"--lock-file", "/tmp/dotkafx.lock",
+			"--listen", "127.0.0.1",
+			"--max-connections", "8",
+			"--read-timeout", "5s",
+		}, testCase.requiredArgs...)
+		require.Equal(required, serverArgs(changed), testCaseName)
+	}
+}
+
+func TestEnsureServer(t *testing.T) {
+	require := assert.New(t)
+
+	// a running Server is not spawned again
+	port := startServer(t)
+	require.NoError(ensureServer(newClient(port), model.RootCommand{Host: "127.0.0.1", Port: port}))
+
+	// a Server on another host cannot be spawned
+	cmd := model.RootCommand{Host: "192.0.2.1", Port: freePort(t)}
+	cli := newClient(cmd.Port).WithHost(cmd.Host).WithTimeouts(100*time.Millisecond, time.Second)
+	require.EqualError(ensureServer(cli, cmd), "The Server can only be spawned on this machine, not on 192.0.2.1")
+}
+
+func TestFailedResponse(t *testing.T) {
+	require := assert.New(t)
+
+	port := startServer(t)
+	silentPort := silentServer(t)
+
+	testCases := map[string]struct {
+		cli           *client.Client
+		line          string
+		requiredCode  string
+		requiredExit  int
+		requiredState string
+	}{
+		"notRunning": {newClient(freePort(t)), "start", errorCodeNotRunning, exitServerNotRunning, ""},
+		"timeout": {
+			newClient(silentPort).WithTimeouts(time.Second, 100*time.Millisecond),
+			"start", errorCodeTimeout, exitError, "",
+		},
+		"rejected": {newClient(port), "stop", model.ErrorCodeInvalidState, exitCommandRejected, "stopped"},
+		"unknown":  {newClient(port), "dance", model.ErrorCodeUnknownCommand, exitCommandRejected, "stopped"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing failedResponse, with %s", testCaseName)
+
+		res, err := testCase.cli.Do(model.Request{Line: testCase.line})
+		require.Error(err, testCaseName)
+		require.Equal(testCase.requiredExit, exitCode(err), testCaseName)
+
+		failed := failedResponse(res, err)
+		require.Equal(model.ProtocolVersion, failed.Version, testCaseName)
+		require.False(failed.OK, testCaseName)
+		require.Equal(testCase.requiredCode, failed.Error.Code, testCaseName)
+		require.NotEmpty(failed.Error.Message, testCaseName)
+		require.Contains(err.Error(), failed.Error.Message, testCaseName)
+		require.Equal(testCase.requiredState, failed.State, testCaseName)
+	}
+
+	// the errors of the client itself, e.g. a refused command
+	err := errors.New("The session command is only used internally")
+	require.Equal(exitError, exitCode(err))
+	var out bytes.Buffer
+	printJSON(&out, failedResponse(model.Response{}, err))
+	printed := map[string]any{}
+	require.NoError(json.Unmarshal(out.Bytes(), &printed))
+	require.Equal(float64(model.ProtocolVersion), printed["version"])
+	require.Equal(false, printed["ok"])
+	require.Equal(map[string]any{"code": errorCodeClientError, "message": err.Error()}, printed["error"])
+}
+
+func TestPrintResponse(t *testing.T) {
+	require := assert.New(t)
+
+	res := model.Response{Version: model.ProtocolVersion, OK: true, Message: "Usage: back <seconds>", State: "running"}
+
+	testCases := map[string]struct {
+		format   model.OutputFormat
+		required string
+	}{
+		"text": {model.OutputText, "Usage: back <seconds>\n"},
+		// the usages are not escaped, and the Response is printed on one line
+		"json": {model.OutputJSON, `{"version":1,"ok":true,"message":"Usage: back <seconds>","state":"running",` +
+			`"gameTime":0,"gameClock":"","nextEvents":null}` + "\n"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing printResponse, with %s", testCaseName)
+
+		var out bytes.Buffer
+		printResponse(&out, testCase.format, res)
+		require.Equal(testCase.required, out.String(), testCaseName)
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		line          string
+		requiredError string
+	}{
+		"serverCommand":   {"back 5", ""},
+		"render":          {"render", ""},
+		"repl":            {"repl", "The repl command is interactive, it needs a terminal"},
+		"tui":             {"tui", "The tui command is interactive, it needs a terminal"},
+		"hotkeys":         {"hotkeys export", ""},
+		"completion":      {"completion bash", ""},
+		"localArgument":   {"render now", "Usage: render"},
+		"noCompletion":    {"completion", "Usage: completion <shell>"},
+		"watch":           {"watch ticks", "The watch command keeps running until the Server shuts down"},
+		"session":         {"Session", "The session command keeps running until the Server shuts down"},
+		"unknown":         {"jump", "Unknown command: jump"},
+		"invalidArgument": {"back five", "Invalid value for [seconds]"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing validateCommand, with %s", testCaseName)
+
+		err := validateCommand(testCase.line)
+		if testCase.requiredError == "" {
+			require.NoError(err, testCaseName)
+			continue
+		}
+		require.Error(err, testCaseName)
+		require.Contains(err.Error(), testCase.requiredError, testCaseName)
+	}
+}
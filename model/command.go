@@ -1,10 +1,55 @@
 package model
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Output formats of the client
+const (
+	OutputText OutputFormat = "text"
+	OutputJSON OutputFormat = "json"
+)
+
+// OutputFormat is the format of the response printed by the client.
+type OutputFormat string
+
+// UnmarshalText accepts the known output formats, so a typo is reported when the arguments are parsed.
+func (of *OutputFormat) UnmarshalText(text []byte) error {
+	switch format := OutputFormat(strings.ToLower(string(text))); format {
+	case OutputText, OutputJSON:
+		*of = format
+		return nil
+	default:
+		return fmt.Errorf("Unknown output format %s, it has to be text or json", text)
+	}
+}
+
 type RootCommand struct {
-	ConfigFile        string `arg:"-f,--config-file" default:"C:\\Users\\your_username\\dotkafx_config.yml"`
-	ConfigProfileName string `arg:"-n,--config-profile-name" default:"default"`
-	Port              int    `arg:"-p,--port" default:"38383"`
-	Command           string `arg:"positional"`
+	ConfigFile        string        `arg:"-f,--config-file" complete:"files" default:"C:\\Users\\your_username\\dotkafx_config.yml"`
+	ConfigProfileName string        `arg:"-n,--config-profile-name" complete:"profiles" default:"default"`
+	Port              int           `arg:"-p,--port" help:"TCP Port of the Server, 38383 by default, the client finds the port of a running Server in its lock file"`
+	LockFile          string        `arg:"--lock-file" complete:"files" help:"lock file of the Server, keeping a second Server from starting and telling the clients its port [default: .dotkafx.lock in the Home folder]"`
+	Socket            string        `arg:"--socket" complete:"files" help:"path of a Unix domain socket the Server listens on besides the TCP Port, the client dials it instead of the TCP Port"`
+	NoTCP             bool          `arg:"--no-tcp" help:"do not listen on the TCP Port, only on the --socket"`
+	HTTPPort          int           `arg:"--http-port" help:"TCP Port of the HTTP API of the Server, 0 disables it" default:"0"`
+	Listen            string        `arg:"--listen" help:"address the Server listens on, use 0.0.0.0 to accept connections from other machines" default:"127.0.0.1"`
+	Token             string        `arg:"--token,env:DOTKAFX_TOKEN" help:"shared secret required by the Server and sent by the client, empty disables authentication"`
+	MaxConnections    int           `arg:"--max-connections" help:"maximum number of concurrent connections on the control port, 0 means unlimited" default:"16"`
+	ReadTimeout       time.Duration `arg:"--read-timeout" help:"time a client has to send its request, 0 means no limit" default:"5s"`
+	Host              string        `arg:"--host" help:"host of the Server the client connects to" default:"localhost"`
+	ConnectTimeout    time.Duration `arg:"--connect-timeout" help:"time the client waits for a connection to the Server, 0 means no limit" default:"3s"`
+	ResponseTimeout   time.Duration `arg:"--response-timeout" help:"time the client waits for the response of the Server, 0 means no limit" default:"2m"`
+	Retries           int           `arg:"--retries" help:"number of times the client retries to connect, waiting twice as long before every retry" default:"2"`
+	Output            OutputFormat  `arg:"--output" complete:"text,json" help:"format of the response printed by the client: text or json" default:"text"`
+	Spawn             bool          `arg:"--spawn" help:"start the Server in the background if it is not running, and send the command once it responds"`
+	Format            string        `arg:"--format" complete:"ahk,xbindkeys,sxhkd" help:"format of the binding file the hotkeys export command prints: ahk, xbindkeys or sxhkd" default:"ahk"`
+	RenderFile        string        `arg:"-o,--render-file" complete:"files" help:"the WAV file the render command writes the timeline into" default:"dotkafx_render.wav"`
+	From              string        `help:"game clock where the render starts (e.g. -1:00, 0:00, 12:30), defaults to the start of the countdown"`
+	To                string        `help:"game clock where the render ends, defaults to the match length"`
+	Compress          bool          `help:"render the clips one after the other, removing the silence between them"`
+	Command           []string      `arg:"positional" help:"the command sent to the Server with its arguments, e.g. back 1m24s"`
 	Debug             bool
 }
 
@@ -12,7 +57,24 @@ func (rc RootCommand) Description() string {
 	return `DotkaFX is a sound effect scheduler for Dota2.
 
 Run it once without a command to spin up the server.
-Run it again with a command argument which can be: start, stop, pause, back, forward or shutdown
+Run it again with a command (e.g. start, pause, back 1m24s, status or shutdown) to send it to the running server,
+run it with the help command to list every command of the server, or help <command> for the details of one.
+Run it with the render command to mix the whole timeline of a profile into a WAV file (see --render-file, --from, --to and --compress).
+Run it with hotkeys export to print the binding file of the Hotkeys of the config (see --format).
+Run it with completion bash, zsh or fish to print the shell completion script (e.g. source <(dotkafx completion bash)).
 Use the dotkafx_config.yml file in your home folder to adjust the timeline or create a personal configuration.
 `
 }
+
+// Line returns the command with its arguments as one line, as it is sent to the Server.
+func (rc RootCommand) Line() string {
+	return strings.Join(rc.Command, " ")
+}
+
+// Redacted returns a copy of the command without the Token, so it can be logged.
+func (rc RootCommand) Redacted() RootCommand {
+	if rc.Token != "" {
+		rc.Token = "<redacted>"
+	}
+	return rc
+}
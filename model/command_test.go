@@ -0,0 +1,38 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+func TestOutputFormat(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		text           string
+		requiredFormat model.OutputFormat
+		requiredError  string
+	}{
+		"text":      {"text", model.OutputText, ""},
+		"json":      {"json", model.OutputJSON, ""},
+		"upperCase": {"JSON", model.OutputJSON, ""},
+		"unknown":   {"xml", "", "Unknown output format xml, it has to be text or json"},
+		"empty":     {"", "", "Unknown output format , it has to be text or json"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing output format, with %s", testCaseName)
+
+		var format model.OutputFormat
+		err := format.UnmarshalText([]byte(testCase.text))
+		if testCase.requiredError != "" {
+			require.EqualError(err, testCase.requiredError, testCaseName)
+			continue
+		}
+		require.NoError(err, testCaseName)
+		require.Equal(testCase.requiredFormat, format, testCaseName)
+	}
+}
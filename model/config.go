@@ -3,7 +3,7 @@ package model
 import (
 	"fmt"
 
-	"dotkafx/tools"
+	"github.com/DonBattery/dotkafx/tools"
 )
 
 type Event struct {
@@ -12,6 +12,7 @@ type Event struct {
 	Interval       int
 	Repeats        int
 	SoundEffect    string
+	CountdownBeeps int
 }
 
 type EventInput struct {
@@ -20,6 +21,7 @@ type EventInput struct {
 	Interval       string `yaml:"Interval"`
 	Repeats        int    `yaml:"Repeats"`
 	SoundEffect    string `yaml:"SoundEffect"`
+	CountdownBeeps string `yaml:"CountdownBeeps"`
 }
 
 func (ei EventInput) Parse() (Event, error) {
@@ -47,26 +49,46 @@ func (ei EventInput) Parse() (Event, error) {
 
 	ev.SoundEffect = ei.SoundEffect
 
+	// CountdownBeeps is optional
+	if ei.CountdownBeeps != "" {
+		val, err = tools.StringToSeconds(ei.CountdownBeeps)
+		if err != nil {
+			return ev, err
+		}
+		if val < 0 {
+			return ev, fmt.Errorf("CountdownBeeps cannot be negative: %s", ei.CountdownBeeps)
+		}
+		ev.CountdownBeeps = val
+	}
+
 	return ev, nil
 }
 
 type ConfigProfile struct {
-	GlobalOffset int
-	MatchLength  int
-	Countdown    int
-	Events       map[string]Event
+	GlobalOffset    int
+	MatchLength     int
+	Countdown       int
+	AnnouncementGap int
+	SoundPacks      []string
+	Events          map[string]Event
+	// Name and ConfigFile tell where the Profile comes from, they are set by CreateAndValidateProfile
+	Name       string
+	ConfigFile string
 }
 
 type ConfigProfileInput struct {
-	GlobalOffset string                `yaml:"GlobalOffset"`
-	MatchLength  string                `yaml:"MatchLength"`
-	Countdown    string                `yaml:"Countdown"`
-	Events       map[string]EventInput `yaml:"Events"`
+	GlobalOffset    string                `yaml:"GlobalOffset"`
+	MatchLength     string                `yaml:"MatchLength"`
+	Countdown       string                `yaml:"Countdown"`
+	AnnouncementGap string                `yaml:"AnnouncementGap"`
+	SoundPacks      []string              `yaml:"SoundPacks"`
+	Events          map[string]EventInput `yaml:"Events"`
 }
 
 func (cpi ConfigProfileInput) Parse() (ConfigProfile, error) {
 	cp := ConfigProfile{
-		Events: make(map[string]Event),
+		SoundPacks: cpi.SoundPacks,
+		Events:     make(map[string]Event),
 	}
 
 	val, err := tools.StringToSeconds(cpi.GlobalOffset)
@@ -87,6 +109,18 @@ func (cpi ConfigProfileInput) Parse() (ConfigProfile, error) {
 	}
 	cp.Countdown = val
 
+	// AnnouncementGap is optional
+	if cpi.AnnouncementGap != "" {
+		val, err = tools.StringToSeconds(cpi.AnnouncementGap)
+		if err != nil {
+			return cp, err
+		}
+		if val < 0 {
+			return cp, fmt.Errorf("AnnouncementGap cannot be negative: %s", cpi.AnnouncementGap)
+		}
+		cp.AnnouncementGap = val
+	}
+
 	if cpi.Events == nil {
 		return cp, fmt.Errorf("The config profile must have an Events map")
 	}
@@ -115,17 +149,32 @@ func (cp ConfigProfile) AllSoundEffect() (soundEffects map[string]bool) {
 	return
 }
 
+// Hotkey binds a key chord (e.g. Ctrl+F2) to a command line of the client (e.g. start or back5).
+type Hotkey struct {
+	Chord   string `yaml:"Chord"`
+	Command string `yaml:"Command"`
+}
+
 type Config struct {
-	Profiles map[string]ConfigProfile
+	SoundPacks []string
+	Profiles   map[string]ConfigProfile
+	// Hotkeys are exported into the binding file of a hotkey tool (e.g. AutoHotkey) by the hotkeys command
+	Hotkeys []Hotkey
+	// File is the path of the config file, empty if the embedded default config is used
+	File string
 }
 
 type ConfigInput struct {
-	Profiles map[string]ConfigProfileInput `yaml:"Profiles"`
+	SoundPacks []string                      `yaml:"SoundPacks"`
+	Profiles   map[string]ConfigProfileInput `yaml:"Profiles"`
+	Hotkeys    []Hotkey                      `yaml:"Hotkeys"`
 }
 
 func (ci ConfigInput) Parse() (Config, error) {
 	c := Config{
-		Profiles: make(map[string]ConfigProfile),
+		SoundPacks: ci.SoundPacks,
+		Profiles:   make(map[string]ConfigProfile),
+		Hotkeys:    ci.Hotkeys,
 	}
 
 	if ci.Profiles == nil {
@@ -147,28 +196,54 @@ func (ci ConfigInput) Parse() (Config, error) {
 	return c, nil
 }
 
+// CreateAndValidateProfile returns the named Profile. The SoundPacks of the Profile are searched first,
+// followed by the SoundPacks defined on the Config level.
 func (conf Config) CreateAndValidateProfile(profileName string) (profile ConfigProfile, err error) {
 	profile, ok := conf.Profiles[profileName]
 	if !ok {
 		err = fmt.Errorf("The profile with the name: %s cannot be found in the configuration.", profileName)
 		return
 	}
+
+	soundPacks := []string{}
+	soundPacks = append(soundPacks, profile.SoundPacks...)
+	soundPacks = append(soundPacks, conf.SoundPacks...)
+	profile.SoundPacks = soundPacks
+	profile.Name = profileName
+	profile.ConfigFile = conf.File
+
 	return
 }
 
 func (conf Config) String() string {
-	out := "Profiles:\n"
+	out := "SoundPacks:\n"
+	for _, soundPack := range conf.SoundPacks {
+		out += "  - " + soundPack + "\n"
+	}
+
+	out += "Hotkeys:\n"
+	for _, hotkey := range conf.Hotkeys {
+		out += "  " + hotkey.Chord + ": " + hotkey.Command + "\n"
+	}
+
+	out += "Profiles:\n"
 
 	for profileName, profile := range conf.Profiles {
 		out += "  " + profileName + ":\n"
 		out += fmt.Sprintf(
-			`    GlobalOffset: %s
-    MatchLength : %s
-    Countdown   : %s
+			`    GlobalOffset   : %s
+    MatchLength    : %s
+    Countdown      : %s
+    AnnouncementGap: %s
 `,
 			tools.SecondsToString(profile.GlobalOffset),
 			tools.SecondsToString(profile.MatchLength),
-			tools.SecondsToString(profile.Countdown))
+			tools.SecondsToString(profile.Countdown),
+			tools.SecondsToString(profile.AnnouncementGap))
+		out += "    SoundPacks:\n"
+		for _, soundPack := range profile.SoundPacks {
+			out += "      - " + soundPack + "\n"
+		}
 		out += "    Events:\n"
 		for eventName, event := range profile.Events {
 			out += "      " + eventName + ":\n"
@@ -178,12 +253,14 @@ func (conf Config) String() string {
         Interval      : %s
         Repeats       : %d
         SoundEffect   : %s
+        CountdownBeeps: %s
 `,
 				tools.SecondsToString(event.Offset),
 				tools.SecondsToString(event.FirstHappensAt),
 				tools.SecondsToString(event.Interval),
 				event.Repeats,
 				event.SoundEffect,
+				tools.SecondsToString(event.CountdownBeeps),
 			)
 		}
 	}
@@ -0,0 +1,35 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+func TestCreateAndValidateProfileSoundPacks(t *testing.T) {
+	require := assert.New(t)
+
+	conf := model.Config{
+		SoundPacks: []string{"config_pack"},
+		Profiles: map[string]model.ConfigProfile{
+			"with_packs":    {SoundPacks: []string{"profile_pack_1", "profile_pack_2"}},
+			"without_packs": {},
+		},
+		File: "dotkafx_config.yml",
+	}
+
+	profile, err := conf.CreateAndValidateProfile("with_packs")
+	require.NoError(err)
+	require.Equal([]string{"profile_pack_1", "profile_pack_2", "config_pack"}, profile.SoundPacks)
+	require.Equal("with_packs", profile.Name)
+	require.Equal("dotkafx_config.yml", profile.ConfigFile)
+
+	profile, err = conf.CreateAndValidateProfile("without_packs")
+	require.NoError(err)
+	require.Equal([]string{"config_pack"}, profile.SoundPacks)
+
+	_, err = conf.CreateAndValidateProfile("missing")
+	require.EqualError(err, "The profile with the name: missing cannot be found in the configuration.")
+}
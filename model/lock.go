@@ -0,0 +1,33 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultPort is the TCP Port of the Server if none is given, and the one the client dials if it finds no lock file.
+const DefaultPort = 38383
+
+// ServerLock is the content of the lock file of a running Server. It keeps a second Server from starting,
+// and tells the clients where the Server listens. Port is 0 if the Server does not listen on TCP.
+type ServerLock struct {
+	PID       int       `json:"pid"`
+	Port      int       `json:"port"`
+	Socket    string    `json:"socket,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// ReadServerLock reads the lock file of a Server.
+func ReadServerLock(path string) (ServerLock, error) {
+	var lock ServerLock
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lock, err
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return lock, fmt.Errorf("Failed to parse the lock file %s: %s", path, err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,221 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion is the version of the JSON protocol spoken on the control port.
+// A request is treated as JSON if its line starts with a "{", otherwise it is a legacy text command.
+const ProtocolVersion = 1
+
+// TextTokenPrefix is the prefix of the shared secret in a legacy text command (e.g. "token=secret start").
+const TextTokenPrefix = "token="
+
+// Durations are sent as integer milliseconds in the JSON protocol, their fields are int64 instead of time.Duration.
+
+// Error codes of the JSON protocol
+const (
+	ErrorCodeBadRequest         = "bad_request"
+	ErrorCodeUnsupportedVersion = "unsupported_version"
+	ErrorCodeUnknownCommand     = "unknown_command"
+	ErrorCodeInvalidArgument    = "invalid_argument"
+	ErrorCodeInvalidState       = "invalid_state"
+	ErrorCodeSoundError         = "sound_error"
+	ErrorCodeUnauthorized       = "unauthorized"
+	ErrorCodeBusy               = "busy"
+	ErrorCodeInternal           = "internal"
+)
+
+// Request is a JSON request sent to the Server. Seconds is used by the back and forward commands,
+// Name by the play and preview commands. Events is the number of upcoming events to include in the Response.
+// Token is the shared secret, required if the Server is run with one. From and To are the game clocks
+// (e.g. "-1:00" or "12:30") of the window of the timeline command. Ticks makes the watch command stream
+// a tick Notification every second of the game clock. Line is a command line of the text protocol (e.g. "back 1m24s"),
+// it is parsed into the Command and its arguments if Command is empty.
+type Request struct {
+	Version int    `json:"version"`
+	ID      string `json:"id,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Command string `json:"command"`
+	Seconds int    `json:"seconds,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Events  int    `json:"events,omitempty"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Ticks   bool   `json:"ticks,omitempty"`
+	Line    string `json:"line,omitempty"`
+}
+
+// ProtocolError is the error of a failed Request.
+type ProtocolError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (pe *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s", pe.Code, pe.Message)
+}
+
+// NewProtocolError creates a ProtocolError with a formatted message.
+func NewProtocolError(code string, format string, args ...any) *ProtocolError {
+	return &ProtocolError{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// UpcomingEvent is an occurrence of an Event on the timeline.
+type UpcomingEvent struct {
+	Name        string `json:"name"`
+	SoundEffect string `json:"soundEffect"`
+	// GameTime is the time of the occurrence in seconds, as represented in the game
+	GameTime  int    `json:"gameTime"`
+	GameClock string `json:"gameClock"`
+	// In is the number of seconds until the occurrence
+	In int `json:"in"`
+}
+
+// TimelineEntry is an occurrence of an Event on the computed timeline.
+type TimelineEntry struct {
+	Name        string `json:"name"`
+	SoundEffect string `json:"soundEffect"`
+	GameTime    int    `json:"gameTime"`
+	GameClock   string `json:"gameClock"`
+	// ClipLength is the length of the SoundEffect in milliseconds (0 if unknown)
+	ClipLength int64 `json:"clipLength"`
+	// Shift is the number of seconds the occurrence was moved to avoid overlapping announcements
+	Shift int `json:"shift"`
+}
+
+// Clock is the state of the Scheduler and the current game time.
+type Clock struct {
+	State     string `json:"state"`
+	GameTime  int    `json:"gameTime"`
+	GameClock string `json:"gameClock"`
+}
+
+// ServerStatus describes the running Server: the Profile it uses, where the Profile comes from and how long it is up.
+type ServerStatus struct {
+	Profile    string    `json:"profile"`
+	ConfigFile string    `json:"configFile"`
+	StartedAt  time.Time `json:"startedAt"`
+	// Uptime is in milliseconds, rounded to seconds
+	Uptime int64 `json:"uptime"`
+}
+
+// SoundInfo describes a resolvable sound effect, where it is loaded from and how long it is.
+type SoundInfo struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	// Duration is in milliseconds
+	Duration int64 `json:"duration"`
+}
+
+// CommandInfo describes a command of the Server with its arguments, as listed by the help command.
+type CommandInfo struct {
+	Name    string         `json:"name"`
+	Aliases []string       `json:"aliases,omitempty"`
+	Usage   string         `json:"usage"`
+	Help    string         `json:"help"`
+	Args    []ArgumentInfo `json:"args,omitempty"`
+}
+
+// ArgumentInfo describes an argument of a command. Kind is one of duration, name, game clock, number and switch.
+type ArgumentInfo struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Optional bool   `json:"optional"`
+	Help     string `json:"help"`
+}
+
+// Response is the JSON response of the Server. Every Response carries the state of the Scheduler,
+// the current game time and the upcoming events, regardless of the command.
+type Response struct {
+	Version    int             `json:"version"`
+	ID         string          `json:"id,omitempty"`
+	OK         bool            `json:"ok"`
+	Error      *ProtocolError  `json:"error,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	State      string          `json:"state"`
+	GameTime   int             `json:"gameTime"`
+	GameClock  string          `json:"gameClock"`
+	NextEvents []UpcomingEvent `json:"nextEvents"`
+	Sounds     []SoundInfo     `json:"sounds,omitempty"`
+	Cues       *CueMetrics     `json:"cues,omitempty"`
+	Status     *ServerStatus   `json:"status,omitempty"`
+	Timeline   []TimelineEntry `json:"timeline,omitempty"`
+	Commands   []CommandInfo   `json:"commands,omitempty"`
+}
+
+// CueMetrics describes the delivery of the sound cues from the Scheduler to the speaker.
+// Dropped cues did not fit into the queue of the sound player, late cues were played after LateThreshold,
+// skipped cues were so late that playing them would have been misleading. MaxDelay and LateThreshold are in milliseconds.
+type CueMetrics struct {
+	Queued        int   `json:"queued"`
+	Capacity      int   `json:"capacity"`
+	Played        int   `json:"played"`
+	Dropped       int   `json:"dropped"`
+	Late          int   `json:"late"`
+	Skipped       int   `json:"skipped"`
+	MaxDelay      int64 `json:"maxDelay"`
+	LateThreshold int64 `json:"lateThreshold"`
+}
+
+// Kinds of the Notifications published by the Scheduler
+const (
+	NotificationState         = "state"
+	NotificationTimelineEvent = "event"
+	NotificationStarted       = "started"
+	NotificationRestarted     = "restarted"
+	NotificationPaused        = "paused"
+	NotificationResumed       = "resumed"
+	NotificationStopped       = "stopped"
+	NotificationMatchEnded    = "ended"
+	NotificationRolledBack    = "back"
+	NotificationRolledForward = "forward"
+	NotificationTick          = "tick"
+	NotificationCountdown     = "countdown"
+)
+
+// Notification is published by the Scheduler whenever something happens: a timeline event fires, the state changes,
+// the match ends, the Scheduler is rolled back or forward, a second passes on the game clock, or a countdown beep is due.
+// Event, SoundEffect and Occurrence (the index of the occurrence of the Event, starting from 1) are only set for
+// timeline events and countdowns. Seconds is the amount of the back and forward adjustments, and the seconds remaining
+// until the Event for countdowns. Time is the moment the Notification was published, used to tell late cues apart.
+type Notification struct {
+	Kind        string    `json:"kind"`
+	Time        time.Time `json:"time"`
+	State       string    `json:"state"`
+	GameTime    int       `json:"gameTime"`
+	GameClock   string    `json:"gameClock"`
+	Event       string    `json:"event,omitempty"`
+	SoundEffect string    `json:"soundEffect,omitempty"`
+	Occurrence  int       `json:"occurrence,omitempty"`
+	Seconds     int       `json:"seconds,omitempty"`
+}
+
+// String returns the Notification as a human readable line, as it is streamed by the watch command of the text protocol.
+func (n Notification) String() string {
+	var text string
+	switch n.Kind {
+	case NotificationTimelineEvent:
+		text = n.Event
+		if n.Occurrence > 1 {
+			text += fmt.Sprintf(" #%d", n.Occurrence)
+		}
+	case NotificationCountdown:
+		text = fmt.Sprintf("%s in %d seconds", n.Event, n.Seconds)
+	case NotificationRolledBack:
+		text = fmt.Sprintf("Scheduler rolled back by %d seconds", n.Seconds)
+	case NotificationRolledForward:
+		text = fmt.Sprintf("Scheduler rolled forward by %d seconds", n.Seconds)
+	case NotificationMatchEnded:
+		text = "Match ended"
+	case NotificationTick:
+		text = n.State
+	default:
+		text = fmt.Sprintf("Scheduler is %s", n.State)
+	}
+	return fmt.Sprintf("[%s] %s: %s", n.GameClock, n.Kind, text)
+}
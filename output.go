@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// Error codes of the JSON output for the errors of the client, the errors of the Server keep their own codes
+const (
+	errorCodeNotRunning  = "not_running"
+	errorCodeTimeout     = "timeout"
+	errorCodeClientError = "client_error"
+)
+
+// printJSON prints the value as one line of JSON.
+func printJSON(w io.Writer, value any) {
+	encoder := json.NewEncoder(w)
+	// the usages of the commands contain < and >
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		quit(err)
+	}
+}
+
+// printResponse prints the Response of a command: its message as text, or the whole Response as JSON.
+func printResponse(w io.Writer, format model.OutputFormat, res model.Response) {
+	if format == model.OutputJSON {
+		printJSON(w, res)
+		return
+	}
+	fmt.Fprintln(w, res.Message)
+}
+
+// fail prints the error of a command and exits with the exit code of the error. In the JSON format the error is
+// printed as a failed Response.
+func fail(format model.OutputFormat, res model.Response, err error) {
+	if format != model.OutputJSON {
+		quit(err)
+	}
+	printJSON(os.Stdout, failedResponse(res, err))
+	os.Exit(exitCode(err))
+}
+
+// failedResponse returns the Response of the error of a command, with the state of the Scheduler if the Server
+// sent it. The errors of the client get their own codes.
+func failedResponse(res model.Response, err error) model.Response {
+	var (
+		protoErr   *model.ProtocolError
+		connectErr *client.ConnectError
+		timeoutErr *client.TimeoutError
+	)
+	switch {
+	case errors.As(err, &protoErr):
+		res.Error = protoErr
+	case errors.As(err, &connectErr):
+		res.Error = &model.ProtocolError{Code: errorCodeNotRunning, Message: err.Error()}
+	case errors.As(err, &timeoutErr):
+		res.Error = &model.ProtocolError{Code: errorCodeTimeout, Message: err.Error()}
+	default:
+		res.Error = &model.ProtocolError{Code: errorCodeClientError, Message: err.Error()}
+	}
+	res.Version = model.ProtocolVersion
+	res.OK = false
+	return res
+}
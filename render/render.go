@@ -0,0 +1,194 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/sound"
+	"github.com/DonBattery/dotkafx/tools"
+)
+
+const (
+	// compressedGap is the silence between two clips when the render is time-compressed
+	compressedGap = time.Second
+	// filePermissions are the permissions of the rendered file
+	filePermissions = 0644
+)
+
+// Options controls which part of the timeline is rendered and how.
+type Options struct {
+	// From and To are the game times (in seconds) of the rendered window, both inclusive
+	From int
+	To   int
+	// Compress removes the silence between the clips, so they are played one after the other
+	Compress bool
+}
+
+// IndexEntry tells where a timeline event can be heard in the rendered file.
+type IndexEntry struct {
+	Position    time.Duration
+	GameTime    int
+	Name        string
+	SoundEffect string
+}
+
+func (ie IndexEntry) String() string {
+	return fmt.Sprintf("%s GameTime: %s Name: %s SoundEffect: %s",
+		tools.SecondsToString(int(ie.Position.Seconds())),
+		tools.SecondsToString(ie.GameTime),
+		ie.Name,
+		ie.SoundEffect,
+	)
+}
+
+// RenderFile renders the timeline into a temp file next to the path, and renames it to the path once it is
+// complete, so a failed render does not leave a half-written file behind.
+func RenderFile(path string, fx *sound.Player, timeline []scheduler.TimelineEvent, opts Options) ([]IndexEntry, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	// the temp file is only readable by the user, the rendered file is readable like a created one
+	if err := file.Chmod(filePermissions); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	index, err := Render(file, fx, timeline, opts)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return index, os.Rename(file.Name(), path)
+}
+
+// Render mixes every clip of the timeline within the window of the Options at its scheduled offset,
+// and writes the result into w as a WAV file. It returns the index of the rendered clips.
+func Render(w io.WriteSeeker, fx *sound.Player, timeline []scheduler.TimelineEvent, opts Options) ([]IndexEntry, error) {
+	if opts.To < opts.From {
+		return nil, fmt.Errorf("The end of the render window (%s) is before its start (%s)",
+			tools.SecondsToString(opts.To), tools.SecondsToString(opts.From))
+	}
+
+	format := fx.Format()
+	index := []IndexEntry{}
+	clips := []placedClip{}
+	cursor := 0 // the position in samples after the last placed clip
+
+	for _, event := range timeline {
+		if event.GameTime < opts.From || event.GameTime > opts.To {
+			continue
+		}
+
+		// every loaded sound is already resampled to the Format of the Player
+		clip, _, ok := fx.Clip(event.SoundEffect)
+		if !ok {
+			return nil, fmt.Errorf("The sound %s of the event %s is not loaded", event.SoundEffect, event.Name)
+		}
+		clipLength := clip.Len()
+
+		position := format.SampleRate.N(time.Duration(event.GameTime-opts.From) * time.Second)
+		if opts.Compress {
+			position = cursor
+			if len(clips) > 0 {
+				position += format.SampleRate.N(compressedGap)
+			}
+		}
+
+		clips = append(clips, placedClip{position: position, clip: clip})
+		index = append(index, IndexEntry{
+			Position:    format.SampleRate.D(position),
+			GameTime:    event.GameTime,
+			Name:        event.Name,
+			SoundEffect: event.SoundEffect,
+		})
+
+		if position+clipLength > cursor {
+			cursor = position + clipLength
+		}
+	}
+
+	if len(clips) == 0 {
+		return nil, fmt.Errorf("There are no timeline events between %s and %s",
+			tools.SecondsToString(opts.From), tools.SecondsToString(opts.To))
+	}
+
+	sort.SliceStable(clips, func(i, j int) bool {
+		return clips[i].position < clips[j].position
+	})
+	return index, wav.Encode(w, beep.Take(cursor, &timelineMixer{pending: clips}), format)
+}
+
+// placedClip is a clip starting at a position (in samples) of the rendered file.
+type placedClip struct {
+	position int
+	clip     beep.Streamer
+}
+
+// timelineMixer streams the placed clips at their positions, and silence where none of them plays. Only the clips
+// playing in the streamed samples are mixed, so the work grows with the length of the file and of the clips,
+// not with their product. It streams silence forever after the last clip.
+type timelineMixer struct {
+	// pending are the clips which have not started yet, sorted by their positions
+	pending  []placedClip
+	playing  []beep.Streamer
+	position int
+	buffer   [][2]float64
+}
+
+func (tm *timelineMixer) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		for len(tm.pending) > 0 && tm.pending[0].position <= tm.position {
+			tm.playing = append(tm.playing, tm.pending[0].clip)
+			tm.pending = tm.pending[1:]
+		}
+
+		// the samples are mixed in segments, which end where the next clip starts
+		segment := samples[n:]
+		if len(tm.pending) > 0 && tm.pending[0].position-tm.position < len(segment) {
+			segment = segment[:tm.pending[0].position-tm.position]
+		}
+		tm.mix(segment)
+		n += len(segment)
+		tm.position += len(segment)
+	}
+	return n, true
+}
+
+func (tm *timelineMixer) Err() error {
+	return nil
+}
+
+// mix adds the samples of the playing clips into the segment, and drops the clips which have ended.
+func (tm *timelineMixer) mix(segment [][2]float64) {
+	for i := range segment {
+		segment[i] = [2]float64{}
+	}
+	if len(tm.buffer) < len(segment) {
+		tm.buffer = make([][2]float64, len(segment))
+	}
+
+	playing := tm.playing[:0]
+	for _, clip := range tm.playing {
+		streamed, ok := clip.Stream(tm.buffer[:len(segment)])
+		for i := 0; i < streamed; i++ {
+			segment[i][0] += tm.buffer[i][0]
+			segment[i][1] += tm.buffer[i][1]
+		}
+		if ok && streamed == len(segment) {
+			playing = append(playing, clip)
+		}
+	}
+	tm.playing = playing
+}
@@ -0,0 +1,172 @@
+package render_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/render"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+// newPlayer loads the tones of the test timeline, the embedded sounds are looked up in the repository.
+func newPlayer(t *testing.T) *sound.Player {
+	fx := sound.NewPlayer(os.DirFS(".."), nil)
+	profile := model.ConfigProfile{Events: map[string]model.Event{
+		"Single": {SoundEffect: "tone:single"},
+		"Tick":   {SoundEffect: "tone:tick"},
+	}}
+	if err := fx.LoadSounds(profile); err != nil {
+		t.Fatal(err)
+	}
+	return fx
+}
+
+// testTimeline has a single tone every minute, and a tick at -00:00:30.
+var testTimeline = []scheduler.TimelineEvent{
+	{Name: "Tick", SoundEffect: "tone:tick", GameTime: -30},
+	{Name: "Single", SoundEffect: "tone:single", GameTime: 0},
+	{Name: "Single", SoundEffect: "tone:single", GameTime: 60},
+	{Name: "Single", SoundEffect: "tone:single", GameTime: 120},
+}
+
+// decode reads the samples of the rendered WAV file.
+func decode(t *testing.T, path string) [][2]float64 {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	streamer, format, err := wav.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := beep.NewBuffer(format)
+	buffer.Append(streamer)
+
+	samples := make([][2]float64, buffer.Len())
+	buffer.Streamer(0, buffer.Len()).Stream(samples)
+	return samples
+}
+
+func TestRender(t *testing.T) {
+	require := assert.New(t)
+
+	fx := newPlayer(t)
+	rate := sound.SpeakerFormat.SampleRate
+	single := 200 * time.Millisecond
+
+	testCases := map[string]struct {
+		opts              render.Options
+		requiredGameTimes []int
+		requiredPositions []time.Duration
+		requiredLength    int
+	}{
+		"window": {render.Options{From: 0, To: 60}, []int{0, 60},
+			[]time.Duration{0, time.Minute}, rate.N(time.Minute) + rate.N(single)},
+		"countdown": {render.Options{From: -60, To: 0}, []int{-30, 0},
+			[]time.Duration{30 * time.Second, time.Minute}, rate.N(time.Minute) + rate.N(single)},
+		// the clips are played one after the other, with a second between them
+		"compressed": {render.Options{From: -30, To: 120, Compress: true}, []int{-30, 0, 60, 120},
+			[]time.Duration{0, 1060 * time.Millisecond, 2260 * time.Millisecond, 3460 * time.Millisecond},
+			rate.N(3460*time.Millisecond) + rate.N(single)},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing Render, with %s", testCaseName)
+
+		path := filepath.Join(t.TempDir(), "render.wav")
+		file, err := os.Create(path)
+		require.NoError(err, testCaseName)
+		index, err := render.Render(file, fx, testTimeline, testCase.opts)
+		require.NoError(err, testCaseName)
+		require.NoError(file.Close(), testCaseName)
+
+		gameTimes, positions := []int{}, []time.Duration{}
+		for _, entry := range index {
+			gameTimes = append(gameTimes, entry.GameTime)
+			positions = append(positions, entry.Position)
+		}
+		require.Equal(testCase.requiredGameTimes, gameTimes, testCaseName)
+		require.Equal(testCase.requiredPositions, positions, testCaseName)
+
+		// every clip is heard at the sample offset of its index entry, and there is silence before it
+		samples := decode(t, path)
+		require.Equal(testCase.requiredLength, len(samples), testCaseName)
+		for _, entry := range index {
+			offset := rate.N(entry.Position)
+			if offset > 0 {
+				require.Equal([2]float64{}, samples[offset-1], "%s: at %s", testCaseName, entry.Position)
+			}
+			heard := false
+			for _, sample := range samples[offset : offset+rate.N(time.Millisecond)] {
+				heard = heard || sample != [2]float64{}
+			}
+			require.True(heard, "%s: at %s", testCaseName, entry.Position)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	require := assert.New(t)
+
+	fx := newPlayer(t)
+
+	testCases := map[string]struct {
+		opts          render.Options
+		requiredError string
+	}{
+		"endBeforeStart": {render.Options{From: 60, To: 0}, "The end of the render window (00:00:00) is before its start (00:01:00)"},
+		"emptyWindow":    {render.Options{From: 180, To: 300}, "There are no timeline events between 00:03:00 and 00:05:00"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing Render errors, with %s", testCaseName)
+
+		file, err := os.Create(filepath.Join(t.TempDir(), "render.wav"))
+		require.NoError(err, testCaseName)
+		_, err = render.Render(file, fx, testTimeline, testCase.opts)
+		require.EqualError(err, testCase.requiredError, testCaseName)
+		require.NoError(file.Close(), testCaseName)
+	}
+}
+
+func TestRenderFile(t *testing.T) {
+	require := assert.New(t)
+
+	fx := newPlayer(t)
+
+	testCases := map[string]struct {
+		opts          render.Options
+		requiredError bool
+	}{
+		"rendered": {render.Options{From: 0, To: 60}, false},
+		// a failed render leaves no file behind
+		"emptyWindow": {render.Options{From: 180, To: 300}, true},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing RenderFile, with %s", testCaseName)
+
+		dir := t.TempDir()
+		_, err := render.RenderFile(filepath.Join(dir, "render.wav"), fx, testTimeline, testCase.opts)
+
+		entries, readErr := os.ReadDir(dir)
+		require.NoError(readErr, testCaseName)
+		if testCase.requiredError {
+			require.Error(err, testCaseName)
+			require.Empty(entries, testCaseName)
+			continue
+		}
+		require.NoError(err, testCaseName)
+		require.Len(entries, 1, testCaseName)
+		require.Equal("render.wav", entries[0].Name(), testCaseName)
+	}
+}
@@ -0,0 +1,112 @@
+package repl
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// Completer completes command lines with the names of the commands, events and sounds of the Server.
+type Completer struct {
+	commands map[string]model.CommandInfo
+	names    []string
+	events   []string
+	sounds   []string
+}
+
+// NewCompleter creates a Completer of the given commands (with their aliases), event names and sound names.
+func NewCompleter(commands []model.CommandInfo, events []string, sounds []string) *Completer {
+	c := &Completer{
+		commands: make(map[string]model.CommandInfo),
+		events:   unique(events),
+		sounds:   unique(sounds),
+	}
+	for _, cmd := range commands {
+		for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+			c.commands[name] = cmd
+			c.names = append(c.names, name)
+		}
+	}
+	sort.Strings(c.names)
+	return c
+}
+
+// unique returns the sorted names without duplicates.
+func unique(names []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Complete completes the end of the line. It returns the completed line, and the candidates if the completion
+// is ambiguous. The first word is completed with the names of the commands, the arguments with the names
+// the command expects: sound names for play, event names for preview, command names for help.
+func (c *Completer) Complete(line string) (string, []string) {
+	word, rest, hasArgs := strings.Cut(line, " ")
+	if !hasArgs {
+		return complete(line, "", word, c.names, " ")
+	}
+
+	cmd, ok := c.commands[strings.ToLower(word)]
+	if !ok || len(cmd.Args) == 0 {
+		return line, nil
+	}
+
+	head := word + " "
+	rest = strings.TrimLeft(rest, " ")
+	switch {
+	case cmd.Name == "play":
+		return complete(line, head, rest, c.sounds, "")
+	case cmd.Name == "preview":
+		return complete(line, head, rest, c.events, "")
+	case cmd.Name == "help":
+		return complete(line, head, rest, c.names, "")
+	}
+
+	// the other arguments are single words, only the switches have a name to complete
+	lastSpace := strings.LastIndex(rest, " ")
+	head += rest[:lastSpace+1]
+	value := rest[lastSpace+1:]
+	argIndex := len(strings.Fields(rest[:lastSpace+1]))
+	if argIndex < len(cmd.Args) && cmd.Args[argIndex].Kind == "switch" {
+		return complete(line, head, value, []string{cmd.Args[argIndex].Name}, "")
+	}
+	return line, nil
+}
+
+// complete completes the prefix with the common prefix of the matching candidates (case-insensitive). If there is
+// only one match, the suffix is appended to it. The matches are returned if there are more than one of them.
+func complete(line string, head string, prefix string, candidates []string, suffix string) (string, []string) {
+	matches := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(prefix)) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return line, nil
+	case 1:
+		return head + matches[0] + suffix, nil
+	}
+
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(strings.ToLower(match), strings.ToLower(common)) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(common) < len(prefix) {
+		return line, matches
+	}
+	return head + common, matches
+}
@@ -0,0 +1,60 @@
+package repl_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/repl"
+)
+
+func TestComplete(t *testing.T) {
+	require := assert.New(t)
+
+	completer := repl.NewCompleter(
+		[]model.CommandInfo{
+			{Name: "start", Aliases: []string{"restart"}},
+			{Name: "stop"},
+			{Name: "status", Args: []model.ArgumentInfo{{Name: "events", Kind: "number", Optional: true}}},
+			{Name: "pause", Aliases: []string{"resume", "unpause"}},
+			{Name: "play", Args: []model.ArgumentInfo{{Name: "sound name", Kind: "name"}}},
+			{Name: "preview", Args: []model.ArgumentInfo{{Name: "event name", Kind: "name"}}},
+			{Name: "help", Args: []model.ArgumentInfo{{Name: "command", Kind: "name", Optional: true}}},
+			{Name: "watch", Args: []model.ArgumentInfo{{Name: "ticks", Kind: "switch", Optional: true}}},
+		},
+		[]string{"Bounty Runes", "Power Rune", "Bounty Runes", "Wisdom Rune"},
+		[]string{"bounty_runes_appeared", "power_rune_appeared", "beep"},
+	)
+
+	testCases := map[string]struct {
+		line               string
+		requiredLine       string
+		requiredCandidates []string
+	}{
+		"uniqueCommand":       {"wa", "watch ", nil},
+		"alias":               {"rest", "restart ", nil},
+		"caseInsensitive":     {"WA", "watch ", nil},
+		"commonPrefix":        {"s", "st", []string{"start", "status", "stop"}},
+		"ambiguousPrefix":     {"sta", "sta", []string{"start", "status"}},
+		"noMatch":             {"x", "x", nil},
+		"soundName":           {"play po", "play power_rune_appeared", nil},
+		"soundNamePrefix":     {"play b", "play b", []string{"beep", "bounty_runes_appeared"}},
+		"eventNameWithSpaces": {"preview bounty", "preview Bounty Runes", nil},
+		"eventNameDuplicates": {"preview Bo", "preview Bounty Runes", nil},
+		"eventNamePrefix":     {"preview ", "preview ", []string{"Bounty Runes", "Power Rune", "Wisdom Rune"}},
+		"helpCommand":         {"help unp", "help unpause", nil},
+		"switch":              {"watch t", "watch ticks", nil},
+		"numberArgument":      {"status 1", "status 1", nil},
+		"unknownCommand":      {"foo b", "foo b", nil},
+		"noArguments":         {"stop s", "stop s", nil},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing complete, with %s", testCaseName)
+
+		line, candidates := completer.Complete(testCase.line)
+		require.Equal(testCase.requiredLine, line, testCaseName)
+		require.Equal(testCase.requiredCandidates, candidates, testCaseName)
+	}
+}
@@ -0,0 +1,200 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// prompt is the prompt of the REPL
+const prompt = "dotkafx> "
+
+// exitCommands leave the REPL without shutting down the Server, they are not sent to the Server
+var exitCommands = map[string]bool{"exit": true, "quit": true}
+
+// streamCommands keep the connection to themselves, they cannot be used in the REPL (the Server refuses them
+// within a session too), and the announcements are printed by the REPL anyway
+var streamCommands = map[string]bool{"watch": true, "session": true}
+
+// REPL is an interactive client of the Server. It keeps a Session open for the commands and a watch stream
+// for the announcements, which are printed between the commands as they happen.
+type REPL struct {
+	cli     *client.Client
+	session *client.Session
+	out     io.Writer
+	mu      sync.Mutex
+}
+
+// New opens a Session to the Server for the REPL.
+func New(cli *client.Client) (*REPL, error) {
+	session, err := cli.Session()
+	if err != nil {
+		return nil, err
+	}
+	return &REPL{cli: cli, session: session}, nil
+}
+
+// Run reads the commands from the input until it ends, an exit command is entered, the context is done or the
+// Server closes the Session. On a terminal the line is editable, the previous commands can be recalled with
+// the arrow keys and the commands, event names and sound names are completed with Tab.
+func (r *REPL) Run(ctx context.Context, in *os.File, out io.Writer) error {
+	defer r.session.Close()
+
+	completer, err := r.completer()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if term.IsTerminal(int(in.Fd())) {
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = term.Restore(int(in.Fd()), state)
+		}()
+
+		terminal := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{in, out}, prompt)
+		if width, height, err := term.GetSize(int(in.Fd())); err == nil && width > 0 {
+			_ = terminal.SetSize(width, height)
+		}
+		terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+			if key != '\t' || pos != len(line) {
+				return "", 0, false
+			}
+			completed, candidates := completer.Complete(line)
+			if len(candidates) > 0 {
+				r.println(strings.Join(candidates, "  "))
+			}
+			return completed, len(completed), true
+		}
+		r.out = terminal
+
+		go r.watch(ctx, cancel)
+		return r.loop(ctx, terminal.ReadLine)
+	}
+
+	r.out = out
+	go r.watch(ctx, cancel)
+	scanner := bufio.NewScanner(in)
+	return r.loop(ctx, func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return scanner.Text(), nil
+	})
+}
+
+// loop executes the lines returned by readLine on the Session and prints the responses.
+func (r *REPL) loop(ctx context.Context, readLine func() (string, error)) error {
+	for ctx.Err() == nil {
+		line, err := readLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if exitCommands[strings.ToLower(line)] {
+			return nil
+		}
+		if word, _, _ := strings.Cut(line, " "); streamCommands[strings.ToLower(word)] {
+			r.println(fmt.Sprintf("The %s command cannot be used in the REPL, the announcements are printed anyway", strings.ToLower(word)))
+			continue
+		}
+
+		res, err := r.session.Send(line)
+		var protoErr *model.ProtocolError
+		switch {
+		case errors.As(err, &protoErr):
+			r.println(protoErr.Message)
+		case err != nil:
+			return err
+		default:
+			r.println(res.Message)
+		}
+	}
+	return nil
+}
+
+// completer fetches the names of the commands, events and sounds from the Server.
+func (r *REPL) completer() (*Completer, error) {
+	help, err := r.session.Do(model.Request{Command: "help"})
+	if err != nil {
+		return nil, err
+	}
+	sounds, err := r.session.Do(model.Request{Command: "sounds"})
+	if err != nil {
+		return nil, err
+	}
+	timeline, err := r.session.Do(model.Request{Command: "timeline"})
+	if err != nil {
+		return nil, err
+	}
+
+	commands := []model.CommandInfo{}
+	for _, command := range help.Commands {
+		if !streamCommands[command.Name] {
+			commands = append(commands, command)
+		}
+	}
+	soundNames := []string{}
+	for _, sound := range sounds.Sounds {
+		soundNames = append(soundNames, sound.Name)
+	}
+	eventNames := []string{}
+	for _, entry := range timeline.Timeline {
+		eventNames = append(eventNames, entry.Name)
+	}
+	return NewCompleter(commands, eventNames, soundNames), nil
+}
+
+// watch prints the announcements of the Server until the context is done or the Server shuts down,
+// in which case the REPL is stopped too.
+func (r *REPL) watch(ctx context.Context, stop context.CancelFunc) {
+	defer stop()
+
+	err := r.cli.Watch(ctx, false, func(notification model.Notification) {
+		r.println(notification.String())
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		r.println(fmt.Sprintf("The announcements stopped: %s", err))
+		return
+	}
+	r.println("The Server closed the stream of the announcements, press Enter to leave")
+}
+
+// println prints a line above the prompt.
+func (r *REPL) println(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, _ = fmt.Fprintln(r.out, line)
+}
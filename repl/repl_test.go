@@ -0,0 +1,94 @@
+package repl_test
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/repl"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+// syncBuffer is a Buffer which can be written by the announcements and the responses at the same time.
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mu     sync.Mutex
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buffer.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buffer.String()
+}
+
+func TestRun(t *testing.T) {
+	require := assert.New(t)
+
+	profile := model.ConfigProfile{
+		Name:        "test",
+		Countdown:   60,
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			"Bounty Runes": {FirstHappensAt: 180, Interval: 180, SoundEffect: "bounty_runes_appeared"},
+		},
+	}
+	// the sounds are listed for the completion, there are only the generated tones without an embedded_sounds folder
+	embedded := fstest.MapFS{"embedded_sounds": &fstest.MapFile{Mode: fs.ModeDir}}
+	srv := server.NewServer(sound.NewPlayer(embedded, nil), scheduler.NewScheduler(profile, nil),
+		model.RootCommand{Listen: "127.0.0.1"}, embed.FS{})
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	r, err := repl.New(client.NewClient(srv.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, input, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	_, err = input.WriteString("start\nwatch ticks\nsession\nstatus 1\nexit\nstop\n")
+	require.NoError(err)
+	require.NoError(input.Close())
+
+	var out syncBuffer
+	require.NoError(r.Run(context.Background(), in, &out))
+
+	output := out.String()
+	require.Contains(output, "Scheduler started")
+	require.Contains(output, "The watch command cannot be used in the REPL, the announcements are printed anyway\n")
+	require.Contains(output, "The session command cannot be used in the REPL, the announcements are printed anyway\n")
+	require.Contains(output, "Next events:\n  00:03:00 Bounty Runes in ")
+	// the REPL is left before the stop command
+	require.NotContains(output, "Scheduler stopped")
+}
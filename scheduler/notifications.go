@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/tools"
+)
+
+// notify publishes the Notification on the Bus with the current state and game time.
+// It must be called while holding the mutex of the Scheduler, Publish never blocks so the mutex is never held
+// while waiting for a slow subscriber (e.g. the speaker).
+func (sch *Scheduler) notify(notification model.Notification) {
+	notification.Time = time.Now()
+	notification.State = sch.state
+	notification.GameTime = sch.secondsFromStart - sch.profile.Countdown
+	notification.GameClock = tools.SecondsToString(notification.GameTime)
+
+	sch.Bus.Publish(notification)
+}
+
+// Snapshot returns a Notification of the "state" kind with the current state and game time.
+func (sch *Scheduler) Snapshot() model.Notification {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	gameTime := sch.secondsFromStart - sch.profile.Countdown
+	return model.Notification{
+		Kind:      model.NotificationState,
+		Time:      time.Now(),
+		State:     sch.state,
+		GameTime:  gameTime,
+		GameClock: tools.SecondsToString(gameTime),
+	}
+}
@@ -1,45 +1,99 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
-	"math"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
-	"dotkafx/log"
-	"dotkafx/model"
-	"dotkafx/sound"
-	"dotkafx/tools"
+	"github.com/DonBattery/dotkafx/bus"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/tools"
 )
 
+// defaultClipLength is the assumed length (in seconds) of a SoundEffect when its real length is unknown
+const defaultClipLength = 2
+
 type timeLineEvent struct {
-	name        string
-	happensAt   int
-	soundEffect string
+	name           string
+	occurrence     int
+	happensAt      int
+	scheduledAt    int
+	soundEffect    string
+	clipLength     time.Duration
+	countdownBeeps int
+}
+
+// clipSeconds returns the length of the SoundEffect in whole seconds (rounded up)
+func (tle *timeLineEvent) clipSeconds() int {
+	if tle.clipLength <= 0 {
+		return defaultClipLength
+	}
+	return int((tle.clipLength + time.Second - 1) / time.Second)
+}
+
+// TimelineEvent is a read-only copy of an occurrence of an Event on the timeline.
+type TimelineEvent struct {
+	Name        string
+	SoundEffect string
+	// Occurrence is the index of the occurrence of the Event (starting from 1)
+	Occurrence int
+	// HappensAt is the number of seconds from Start
+	HappensAt int
+	// GameTime is the time of the occurrence as represented in the game
+	GameTime int
+	// ClipLength is the length of the SoundEffect (0 if unknown)
+	ClipLength time.Duration
+	// Shift is the number of seconds the occurrence was moved to avoid overlapping with other SoundEffects
+	Shift int
+}
+
+// StateError is returned when a command is not allowed in the current state of the Scheduler.
+type StateError struct {
+	State   string
+	message string
+}
+
+func (se *StateError) Error() string {
+	return se.message
 }
 
 type Scheduler struct {
 	profile          model.ConfigProfile
+	clipLengths      map[string]time.Duration
 	state            string
 	secondsFromStart int
 	timeline         []*timeLineEvent
-	EventChan        chan string
-	mu               sync.Mutex
+	Bus              *bus.Bus
+	// ticks advance the game clock while Run is running, nil means every second
+	ticks <-chan time.Time
+	mu    sync.Mutex
 }
 
 // NewScheduler  creates a new Scheduler initialized with the ConfigProfile in the "stopped" state.
-func NewScheduler(profile model.ConfigProfile) *Scheduler {
+// Everything happening in the Scheduler is published as a Notification on its Bus.
+// The game clock only advances while Run is running.
+// The clipLengths are the lengths of the SoundEffects, used to keep the announcements from overlapping.
+func NewScheduler(profile model.ConfigProfile, clipLengths map[string]time.Duration) *Scheduler {
 	sch := &Scheduler{
-		profile:   profile,
-		EventChan: make(chan string),
-		state:     "stopped",
+		profile:     profile,
+		clipLengths: clipLengths,
+		Bus:         bus.New(),
+		state:       "stopped",
 	}
 
 	sch.buildTimeline()
 
-	go sch.initTicker()
+	return sch
+}
 
+// WithTicks makes Run tick on every value of the channel instead of every second, e.g. to stop the game clock
+// in tests.
+func (sch *Scheduler) WithTicks(ticks <-chan time.Time) *Scheduler {
+	sch.ticks = ticks
 	return sch
 }
 
@@ -68,9 +122,13 @@ func (sc *Scheduler) buildTimeline() {
 			}
 
 			sc.timeline = append(sc.timeline, &timeLineEvent{
-				name:        eventName,
-				soundEffect: event.SoundEffect,
-				happensAt:   nextOccurrenceAt,
+				name:           eventName,
+				occurrence:     occurred + 1,
+				soundEffect:    event.SoundEffect,
+				happensAt:      nextOccurrenceAt,
+				scheduledAt:    nextOccurrenceAt,
+				clipLength:     sc.clipLengths[event.SoundEffect],
+				countdownBeeps: event.CountdownBeeps,
 			})
 
 			occurred += 1
@@ -78,44 +136,68 @@ func (sc *Scheduler) buildTimeline() {
 	}
 
 	// we sort the timeline
-	sort.Slice(sc.timeline, func(i, j int) bool {
-		return sc.timeline[i].happensAt < (sc.timeline[j].happensAt)
-	})
+	sc.sortTimeline()
 
 	// then we adjust the timeline so there will be no conflicting timelineEvents
-	sc.adjustTimeline(0)
+	sc.adjustTimeline()
 
 	// re-sort the timeline after adjustment
+	sc.sortTimeline()
+}
+
+// sortTimeline sorts the timeline by the time of the occurrences (and by name if they happen at the same time)
+func (sc *Scheduler) sortTimeline() {
 	sort.Slice(sc.timeline, func(i, j int) bool {
-		return sc.timeline[i].happensAt < (sc.timeline[j].happensAt)
+		if sc.timeline[i].happensAt == sc.timeline[j].happensAt {
+			return sc.timeline[i].name < sc.timeline[j].name
+		}
+		return sc.timeline[i].happensAt < sc.timeline[j].happensAt
 	})
 }
 
-// adjustTimeline shifts the overlapping events on the timeline by two seconds recursively (preferring negative adjustment)
-func (sch *Scheduler) adjustTimeline(index int) {
-	if index >= len(sch.timeline) {
-		// We've checked all events, so we're done
-		return
-	}
+// overlaps tells if the SoundEffects of two timelineEvents would overlap (or would be closer than the AnnouncementGap)
+// if the first one happened at the given second.
+func (sch *Scheduler) overlaps(ev *timeLineEvent, at int, other *timeLineEvent) bool {
+	gap := sch.profile.AnnouncementGap
+	return at < other.happensAt+other.clipSeconds()+gap && other.happensAt < at+ev.clipSeconds()+gap
+}
 
-	// check for conflicts with previous events
-	for i := 0; i < index; i++ {
-		if math.Abs(float64(sch.timeline[i].happensAt-sch.timeline[index].happensAt)) < 2 {
-			// Conflict! Move the current event by 2 seconds (to the left if possible)
-			if sch.timeline[index].happensAt > 2 {
-				sch.timeline[index].happensAt -= 2
-			} else {
-				sch.timeline[index].happensAt += 2
+// adjustTimeline places the events on the timeline one by one, shifting each one to the closest second where
+// its SoundEffect does not overlap with the already placed ones (preferring negative adjustment). An event is not
+// shifted past the end of the match, where it would never happen: if it does not fit anywhere before the end,
+// it stays where it is scheduled, overlapping the others.
+func (sch *Scheduler) adjustTimeline() {
+	end := sch.profile.Countdown + sch.profile.MatchLength
+	for index, ev := range sch.timeline {
+		placed := sch.timeline[:index]
+
+		fits := func(at int) bool {
+			for _, other := range placed {
+				if sch.overlaps(ev, at, other) {
+					return false
+				}
 			}
+			return true
+		}
 
-			// now that we've moved this event, we need to re-check all previous events
-			sch.adjustTimeline(i)
-			break
+		placedAt := -1
+		for shift := 0; ev.scheduledAt-shift >= 0 || ev.scheduledAt+shift <= end; shift++ {
+			if earlier := ev.scheduledAt - shift; earlier >= 0 && fits(earlier) {
+				placedAt = earlier
+				break
+			}
+			if later := ev.scheduledAt + shift; later <= end && fits(later) {
+				placedAt = later
+				break
+			}
 		}
+		if placedAt < 0 {
+			log.Warn("The SoundEffect of %s #%d at %s overlaps with others, there is no room for it before the end of the match",
+				ev.name, ev.occurrence, tools.SecondsToString(ev.scheduledAt-sch.profile.Countdown))
+			placedAt = ev.scheduledAt
+		}
+		ev.happensAt = placedAt
 	}
-
-	// check next event
-	sch.adjustTimeline(index + 1)
 }
 
 // TimelineString returns the timeline as a string
@@ -123,12 +205,116 @@ func (sc *Scheduler) TimelineString() string {
 	out := ""
 
 	for _, timelineEvent := range sc.timeline {
-		out += fmt.Sprintf("Happens at: %s Name: %s SoundEffect: %s\n", tools.SecondsToString(timelineEvent.happensAt-sc.profile.Countdown), timelineEvent.name, timelineEvent.soundEffect)
+		out += fmt.Sprintf("Happens at: %s Name: %s SoundEffect: %s ClipLength: %.1fs",
+			tools.SecondsToString(timelineEvent.happensAt-sc.profile.Countdown),
+			timelineEvent.name,
+			timelineEvent.soundEffect,
+			timelineEvent.clipLength.Seconds(),
+		)
+		if shift := timelineEvent.happensAt - timelineEvent.scheduledAt; shift != 0 {
+			out += fmt.Sprintf(" Shifted: %+ds", shift)
+		}
+		out += "\n"
 	}
 
 	return out
 }
 
+// Timeline returns a copy of the timeline
+func (sc *Scheduler) Timeline() []TimelineEvent {
+	timeline := []TimelineEvent{}
+
+	for _, timelineEvent := range sc.timeline {
+		timeline = append(timeline, TimelineEvent{
+			Name:        timelineEvent.name,
+			SoundEffect: timelineEvent.soundEffect,
+			Occurrence:  timelineEvent.occurrence,
+			HappensAt:   timelineEvent.happensAt,
+			GameTime:    timelineEvent.happensAt - sc.profile.Countdown,
+			ClipLength:  timelineEvent.clipLength,
+			Shift:       timelineEvent.happensAt - timelineEvent.scheduledAt,
+		})
+	}
+
+	return timeline
+}
+
+// TimelineWindow returns the occurrences of the timeline between the from and to game times (inclusive).
+func (sc *Scheduler) TimelineWindow(from int, to int) []TimelineEvent {
+	window := []TimelineEvent{}
+	for _, event := range sc.Timeline() {
+		if event.GameTime >= from && event.GameTime <= to {
+			window = append(window, event)
+		}
+	}
+	return window
+}
+
+// Profile returns the ConfigProfile the Scheduler was created with.
+func (sc *Scheduler) Profile() model.ConfigProfile {
+	return sc.profile
+}
+
+// EventSoundEffect returns the SoundEffect of the Event with the given name (case-insensitive).
+func (sc *Scheduler) EventSoundEffect(eventName string) (string, bool) {
+	for name, event := range sc.profile.Events {
+		if strings.EqualFold(name, eventName) {
+			return event.SoundEffect, true
+		}
+	}
+	return "", false
+}
+
+// SoundEffects returns every SoundEffect used by the Profile once, in the order of their first occurrence
+// on the timeline. SoundEffects of Events not occurring within the match length are listed at the end.
+func (sc *Scheduler) SoundEffects() []string {
+	soundEffects := []string{}
+	seen := map[string]bool{}
+
+	for _, timelineEvent := range sc.timeline {
+		if !seen[timelineEvent.soundEffect] {
+			seen[timelineEvent.soundEffect] = true
+			soundEffects = append(soundEffects, timelineEvent.soundEffect)
+		}
+	}
+
+	rest := []string{}
+	for soundEffect := range sc.profile.AllSoundEffect() {
+		if !seen[soundEffect] {
+			rest = append(rest, soundEffect)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(soundEffects, rest...)
+}
+
+// Status returns the state of the Scheduler and the current game time in seconds.
+func (sch *Scheduler) Status() (state string, gameTime int) {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+
+	return sch.state, sch.secondsFromStart - sch.profile.Countdown
+}
+
+// NextEvents returns (at most) the next n events of the timeline, which did not happen yet.
+func (sch *Scheduler) NextEvents(n int) []TimelineEvent {
+	sch.mu.Lock()
+	secondsFromStart := sch.secondsFromStart
+	sch.mu.Unlock()
+
+	next := []TimelineEvent{}
+	for _, event := range sch.Timeline() {
+		if len(next) >= n {
+			break
+		}
+		if event.HappensAt >= secondsFromStart {
+			next = append(next, event)
+		}
+	}
+	return next
+}
+
 // gameTime returns the time as represented in the game (00:03:59), considering the seconds elapsed from Start
 // minus the countdown seconds
 func (sch *Scheduler) gameTime() string {
@@ -150,35 +336,80 @@ func (sch *Scheduler) nextEvent() (nextEvent *timeLineEvent, happensNow bool, en
 	return
 }
 
-// initTicker creates a ticker that ticks every Second. If the Scheduler is in the "running" state
-// it checks for the next event in the timeline and if we reached the end of the match. If the next event
-// is happening in the current second we send the name of the correlating SoundEffect to the EventChan.
-// if we have reached the end of the match we are stopping the scheduler.
-func (sch *Scheduler) initTicker() {
+// countdownEvent returns the first timelineEvent with CountdownBeeps happening within its countdown seconds
+// (but not in the current second), or nil if there is none.
+func (sch *Scheduler) countdownEvent() *timeLineEvent {
+	for _, ev := range sch.timeline {
+		remaining := ev.happensAt - sch.secondsFromStart
+		if remaining > 0 && remaining <= ev.countdownBeeps {
+			return ev
+		}
+	}
+	return nil
+}
+
+// Run ticks the Scheduler every second (or on the ticks set by WithTicks) until the context is done.
+func (sch *Scheduler) Run(ctx context.Context) {
+	ticks := sch.ticks
+	if ticks == nil {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+
 	for {
-		sch.mu.Lock()
-		if sch.state == "running" {
-			if sch.secondsFromStart%5 == 0 {
-				log.Debug(sch.gameTime())
-			}
+		sch.tick()
 
-			nextEvent, happensNow, endOfMatch := sch.nextEvent()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+	}
+}
 
-			if happensNow {
-				log.Info("Timeline Event: %s %s", nextEvent.name, sch.gameTime())
-				sch.EventChan <- nextEvent.soundEffect
-			}
+// tick is called every second. If the Scheduler is in the "running" state it publishes a tick Notification,
+// checks for the next event in the timeline and if we reached the end of the match.
+// If the next event is happening in the current second we publish it on the Bus,
+// if an event with CountdownBeeps is coming up we publish a countdown Notification instead.
+// if we have reached the end of the match we are stopping the scheduler.
+func (sch *Scheduler) tick() {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
 
-			if endOfMatch {
-				sch.state = "stopped"
-				log.Info("Maximum match length exceeded, Scheduler stopped automatically. %s", sch.gameTime())
-			}
+	if sch.state == "running" {
+		if sch.secondsFromStart%5 == 0 {
+			log.Debug(sch.gameTime())
+		}
+		sch.notify(model.Notification{Kind: model.NotificationTick})
+
+		nextEvent, happensNow, endOfMatch := sch.nextEvent()
 
-			sch.secondsFromStart += 1
+		if happensNow {
+			log.Info("Timeline Event: %s %s", nextEvent.name, sch.gameTime())
+			sch.notify(model.Notification{
+				Kind:        model.NotificationTimelineEvent,
+				Event:       nextEvent.name,
+				SoundEffect: nextEvent.soundEffect,
+				Occurrence:  nextEvent.occurrence,
+			})
+		} else if countdownEvent := sch.countdownEvent(); countdownEvent != nil {
+			sch.notify(model.Notification{
+				Kind:        model.NotificationCountdown,
+				Event:       countdownEvent.name,
+				SoundEffect: countdownEvent.soundEffect,
+				Occurrence:  countdownEvent.occurrence,
+				Seconds:     countdownEvent.happensAt - sch.secondsFromStart,
+			})
 		}
-		sch.mu.Unlock()
 
-		time.Sleep(time.Second)
+		if endOfMatch {
+			sch.state = "stopped"
+			log.Info("Maximum match length exceeded, Scheduler stopped automatically. %s", sch.gameTime())
+			sch.notify(model.Notification{Kind: model.NotificationMatchEnded})
+		}
+
+		sch.secondsFromStart += 1
 	}
 }
 
@@ -188,56 +419,55 @@ func (sch *Scheduler) Start() string {
 	defer sch.mu.Unlock()
 
 	message := "Scheduler restarted "
+	kind := model.NotificationRestarted
 	if sch.state == "stopped" {
 		message = "Scheduler started "
-		sch.EventChan <- sound.SchedulerStarted
-	} else {
-		sch.EventChan <- sound.SchedulerRestarted
+		kind = model.NotificationStarted
 	}
 
 	sch.state = "running"
 	sch.secondsFromStart = 0
+	sch.notify(model.Notification{Kind: kind})
 
 	return message + sch.gameTime()
 }
 
 // Stop stops the Scheduler without the possibility of resuming
-func (sch *Scheduler) Stop() string {
+func (sch *Scheduler) Stop() (string, error) {
 	sch.mu.Lock()
 	defer sch.mu.Unlock()
 
 	if sch.state == "stopped" {
-		return "Scheduler is already stopped"
+		return "", &StateError{State: sch.state, message: "Scheduler is already stopped"}
 	}
 
 	sch.state = "stopped"
+	sch.notify(model.Notification{Kind: model.NotificationStopped})
 
-	sch.EventChan <- sound.SchedulerStopped
-
-	return "Scheduler stopped. " + sch.gameTime()
+	return "Scheduler stopped. " + sch.gameTime(), nil
 }
 
 // Pause sets the state to "paused" if it was in "running" and vice versa.
-func (sch *Scheduler) Pause() string {
+func (sch *Scheduler) Pause() (string, error) {
 	sch.mu.Lock()
 	defer sch.mu.Unlock()
 
 	switch sch.state {
 	case "running":
 		sch.state = "paused"
-		sch.EventChan <- sound.SchedulerPaused
-		return "Scheduler paused. " + sch.gameTime()
+		sch.notify(model.Notification{Kind: model.NotificationPaused})
+		return "Scheduler paused. " + sch.gameTime(), nil
 	case "paused":
 		sch.state = "running"
-		sch.EventChan <- sound.SchedulerResumed
-		return "Scheduler resumed. " + sch.gameTime()
+		sch.notify(model.Notification{Kind: model.NotificationResumed})
+		return "Scheduler resumed. " + sch.gameTime(), nil
 	default:
-		return fmt.Sprintf("Scheduler cannot be paused/unpaused in the %s state.", sch.state)
+		return "", &StateError{State: sch.state, message: fmt.Sprintf("Scheduler cannot be paused/unpaused in the %s state.", sch.state)}
 	}
 }
 
 // Back rolls the the Scheduler's secondsFromStart back by the input seconds (if it is running).
-func (sch *Scheduler) Back(seconds int) string {
+func (sch *Scheduler) Back(seconds int) (string, error) {
 	sch.mu.Lock()
 	defer sch.mu.Unlock()
 
@@ -249,23 +479,23 @@ func (sch *Scheduler) Back(seconds int) string {
 			movedBackwards = sch.secondsFromStart
 		}
 		sch.secondsFromStart = newSeconds
-		sch.EventChan <- sound.SchedulerRolledBackward
-		return fmt.Sprintf("Scheduler rolled backwards by %d seconds. %s", movedBackwards, sch.gameTime())
+		sch.notify(model.Notification{Kind: model.NotificationRolledBack, Seconds: movedBackwards})
+		return fmt.Sprintf("Scheduler rolled backwards by %d seconds. %s", movedBackwards, sch.gameTime()), nil
 	}
 
-	return fmt.Sprintf("The Scheduler cannot be rolled backwards in the %s state", sch.state)
+	return "", &StateError{State: sch.state, message: fmt.Sprintf("The Scheduler cannot be rolled backwards in the %s state", sch.state)}
 }
 
 // Forward rolls the the Scheduler's secondsFromStart forward by the input seconds (if ti is running).
-func (sch *Scheduler) Forward(seconds int) string {
+func (sch *Scheduler) Forward(seconds int) (string, error) {
 	sch.mu.Lock()
 	defer sch.mu.Unlock()
 
 	if sch.state == "running" {
 		sch.secondsFromStart = sch.secondsFromStart + seconds
-		sch.EventChan <- sound.SchedulerRolledForward
-		return fmt.Sprintf("Scheduler rolled forward by %d seconds. %s", seconds, sch.gameTime())
+		sch.notify(model.Notification{Kind: model.NotificationRolledForward, Seconds: seconds})
+		return fmt.Sprintf("Scheduler rolled forward by %d seconds. %s", seconds, sch.gameTime()), nil
 	}
 
-	return fmt.Sprintf("The Scheduler cannot be rolled forward in the %s state", sch.state)
+	return "", &StateError{State: sch.state, message: fmt.Sprintf("The Scheduler cannot be rolled forward in the %s state", sch.state)}
 }
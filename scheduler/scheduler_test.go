@@ -0,0 +1,197 @@
+package scheduler_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/bus"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+)
+
+func TestTimelineConflicts(t *testing.T) {
+	require := assert.New(t)
+
+	profile := model.ConfigProfile{
+		MatchLength: 600,
+		Events: map[string]model.Event{
+			"Long":  {FirstHappensAt: 100, Repeats: 1, SoundEffect: "long"},
+			"Short": {FirstHappensAt: 101, Repeats: 1, SoundEffect: "short"},
+			"Other": {FirstHappensAt: 200, Repeats: 1, SoundEffect: "unknown"},
+			"Close": {FirstHappensAt: 201, Repeats: 1, SoundEffect: "unknown"},
+		},
+	}
+
+	testCases := map[string]struct {
+		gap          int
+		clipLengths  map[string]time.Duration
+		requiredTime map[string]int
+	}{
+		"unknownClipLengths": {
+			0,
+			nil,
+			map[string]int{"Long": 100, "Short": 102, "Other": 200, "Close": 202},
+		},
+		"realClipLengths": {
+			0,
+			map[string]time.Duration{"long": 2500 * time.Millisecond, "short": time.Second},
+			map[string]int{"Long": 100, "Short": 99, "Other": 200, "Close": 202},
+		},
+		"realClipLengthsWithGap": {
+			1,
+			map[string]time.Duration{"long": 2500 * time.Millisecond, "short": time.Second},
+			map[string]int{"Long": 100, "Short": 98, "Other": 200, "Close": 203},
+		},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing timeline conflicts, with %s", testCaseName)
+		profile.AnnouncementGap = testCase.gap
+		timeline := scheduler.NewScheduler(profile, testCase.clipLengths).Timeline()
+		require.Len(timeline, len(testCase.requiredTime))
+		for i, event := range timeline {
+			require.Equal(testCase.requiredTime[event.Name], event.GameTime, event.Name)
+			require.Equal(event.GameTime-profile.Events[event.Name].FirstHappensAt, event.Shift, event.Name)
+			if i > 0 {
+				require.LessOrEqual(timeline[i-1].GameTime, event.GameTime)
+			}
+		}
+	}
+}
+
+func TestTimelineConflictsAtTheEndOfTheMatch(t *testing.T) {
+	require := assert.New(t)
+
+	profile := model.ConfigProfile{
+		MatchLength: 6,
+		Events: map[string]model.Event{
+			"Long":  {FirstHappensAt: 0, Repeats: 1, SoundEffect: "long"},
+			"Short": {FirstHappensAt: 5, Repeats: 1, SoundEffect: "short"},
+		},
+	}
+	clipLengths := map[string]time.Duration{"long": 10 * time.Second, "short": time.Second}
+
+	// there is no room for Short before the end of the match, so it is not shifted past it
+	timeline := scheduler.NewScheduler(profile, clipLengths).Timeline()
+	require.Len(timeline, 2)
+	require.Equal("Short", timeline[1].Name)
+	require.Equal(5, timeline[1].GameTime)
+	require.Equal(0, timeline[1].Shift)
+}
+
+func TestConcurrentCommandsWithSlowSubscriber(t *testing.T) {
+	require := assert.New(t)
+
+	profile := model.ConfigProfile{
+		Countdown:   60,
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			"Bounty Runes": {FirstHappensAt: 180, Interval: 180, SoundEffect: "bounty_runes_appeared"},
+			"Power Rune":   {FirstHappensAt: 360, Interval: 120, SoundEffect: "power_rune_appeared"},
+		},
+	}
+
+	testCases := map[string]struct {
+		buffer int
+		policy bus.OverflowPolicy
+	}{
+		"dropOldest":     {4, bus.DropOldest},
+		"dropNewest":     {4, bus.DropNewest},
+		"withoutBuffer":  {0, bus.DropOldest},
+		"fullWithBuffer": {1, bus.DropNewest},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing concurrent commands with a slow subscriber, with %s", testCaseName)
+
+		sch := scheduler.NewScheduler(profile, nil)
+		notifications, unsubscribe := sch.Bus.Subscribe("Slow", testCase.buffer, testCase.policy)
+
+		received := 0
+		consumed := make(chan struct{})
+		go func() {
+			defer close(consumed)
+			for range notifications {
+				// a speaker which cannot keep up
+				time.Sleep(20 * time.Millisecond)
+				received++
+			}
+		}()
+
+		commands := []func(){
+			func() { sch.Start() },
+			func() { _, _ = sch.Stop() },
+			func() { _, _ = sch.Pause() },
+			func() { _, _ = sch.Back(5) },
+			func() { _, _ = sch.Forward(30) },
+			func() { sch.Status() },
+			func() { sch.NextEvents(3) },
+			func() { sch.Snapshot() },
+		}
+
+		const workers, iterations = 8, 50
+		var wg sync.WaitGroup
+		started := time.Now()
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < iterations; i++ {
+					commands[(w+i)%len(commands)]()
+				}
+			}(w)
+		}
+		wg.Wait()
+		elapsed := time.Since(started)
+
+		// every command publishes at most one Notification, had the Scheduler waited for the subscriber
+		// the commands would have taken at least 20ms each
+		require.Less(elapsed, time.Second, "the commands were blocked by the slow subscriber")
+		require.Greater(sch.Bus.Dropped()["Slow"], 0)
+
+		unsubscribe()
+		<-consumed
+		require.LessOrEqual(received, workers*iterations)
+	}
+}
+
+func TestWithTicks(t *testing.T) {
+	require := assert.New(t)
+
+	profile := model.ConfigProfile{Countdown: 60, MatchLength: 3600, Events: map[string]model.Event{}}
+	ticks := make(chan time.Time)
+	sch := scheduler.NewScheduler(profile, nil).WithTicks(ticks)
+	notifications, unsubscribe := sch.Bus.Subscribe("Test", 16, bus.DropNewest)
+	defer unsubscribe()
+
+	sch.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sch.Run(ctx)
+	}()
+
+	// Run ticks right away, and then on every tick of the channel
+	gameTimes := []int{}
+	for len(gameTimes) < 3 {
+		notification := <-notifications
+		if notification.Kind != model.NotificationTick {
+			continue
+		}
+		gameTimes = append(gameTimes, notification.GameTime)
+		if len(gameTimes) < 3 {
+			ticks <- time.Now()
+		}
+	}
+	require.Equal([]int{-60, -59, -58}, gameTimes)
+
+	cancel()
+	<-done
+	_, gameTime := sch.Status()
+	require.Equal(-57, gameTime)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// authorize checks the token of a request against the token of the Server. Every request is authorized
+// if the Server is run without a token.
+func (srv *Server) authorize(token string, from string) *model.ProtocolError {
+	if srv.cmd.Token == "" {
+		return nil
+	}
+
+	var protoErr *model.ProtocolError
+	switch {
+	case token == "":
+		protoErr = model.NewProtocolError(model.ErrorCodeUnauthorized, "The token is missing, run the client with --token or set DOTKAFX_TOKEN")
+	case subtle.ConstantTimeCompare([]byte(token), []byte(srv.cmd.Token)) != 1:
+		protoErr = model.NewProtocolError(model.ErrorCodeUnauthorized, "Invalid token")
+	default:
+		return nil
+	}
+
+	log.Warn("Rejected request from %s: %s", from, protoErr.Message)
+	return protoErr
+}
+
+// splitTextToken separates the token from a legacy text command (e.g. "token=secret start").
+func splitTextToken(text string) (token string, command string) {
+	if !strings.HasPrefix(text, model.TextTokenPrefix) {
+		return "", text
+	}
+	token, command, _ = strings.Cut(strings.TrimPrefix(text, model.TextTokenPrefix), " ")
+	return token, strings.TrimSpace(command)
+}
+
+// bearerToken returns the token of the Authorization header of an HTTP request.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
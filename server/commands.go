@@ -0,0 +1,475 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/sound"
+	"github.com/DonBattery/dotkafx/tools"
+)
+
+const (
+	// testAllGap is the silence between two sounds played by the test-all command
+	testAllGap = 500 * time.Millisecond
+	// defaultNextEvents is the number of upcoming events in a JSON Response if the Request does not tell otherwise
+	defaultNextEvents = 3
+	// maxAmount is the maximum number of seconds the Scheduler can be rolled back or forward with one command
+	maxAmount = 1800
+	// maxEvents is the maximum number of upcoming events the status command lists
+	maxEvents = 100
+)
+
+// result is the outcome of a successfully executed command
+type result struct {
+	message  string
+	sounds   []model.SoundInfo
+	cues     *model.CueMetrics
+	status   *model.ServerStatus
+	timeline []model.TimelineEntry
+	commands []model.CommandInfo
+	shutdown bool
+	// watch makes the connection stream the Notifications of the Scheduler after the response,
+	// with the tick Notifications too if ticks is set
+	watch bool
+	ticks bool
+	// session makes the connection execute the following requests too
+	session bool
+}
+
+// schedulerError converts an error of the Scheduler into a ProtocolError.
+func schedulerError(err error) *model.ProtocolError {
+	var stateErr *scheduler.StateError
+	if errors.As(err, &stateErr) {
+		return model.NewProtocolError(model.ErrorCodeInvalidState, "%s", stateErr)
+	}
+	return model.NewProtocolError(model.ErrorCodeInternal, "%s", err)
+}
+
+// amount returns the seconds of a back or forward Request, 1 if it is not given.
+func amount(req model.Request) int {
+	if req.Seconds == 0 {
+		return 1
+	}
+	return req.Seconds
+}
+
+// Commands returns the description of every command of the Server, so they can be listed without a running Server
+// (e.g. for the shell completion).
+func Commands() []model.CommandInfo {
+	return newCommands().infos()
+}
+
+// ParseCommand parses a command line like the Server does, so a command can be validated without a running Server
+// (e.g. the command of a hotkey).
+func ParseCommand(line string) (model.Request, error) {
+	req, protoErr := newCommands().parse(line)
+	if protoErr != nil {
+		return req, protoErr
+	}
+	return req, nil
+}
+
+// newCommands creates the registry of the commands of the Server.
+func newCommands() *registry {
+	return newRegistry(
+		&command{
+			name:    "start",
+			aliases: []string{"restart"},
+			help:    "start the Scheduler, or restart it from the beginning of the countdown",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return result{message: srv.sch.Start()}, nil
+			},
+		},
+		&command{
+			name:   "stop",
+			states: []string{"running", "paused"},
+			help:   "stop the Scheduler without the possibility of resuming",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return schedulerResult(srv.sch.Stop())
+			},
+		},
+		&command{
+			name:    "pause",
+			aliases: []string{"resume", "unpause"},
+			states:  []string{"running", "paused"},
+			help:    "pause the running Scheduler, or resume the paused one",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return schedulerResult(srv.sch.Pause())
+			},
+		},
+		&command{
+			name:    "back",
+			aliases: []string{"backward", "rewind"},
+			args: []argument{
+				{name: "seconds", kind: argDuration, optional: true, help: fmt.Sprintf("seconds or a duration like 1m24s, 1 second by default, at most %s", time.Duration(maxAmount)*time.Second), max: maxAmount},
+			},
+			states: []string{"running"},
+			help:   "roll the Scheduler back, e.g. back 1m24s or back1m24s",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return schedulerResult(srv.sch.Back(amount(req)))
+			},
+		},
+		&command{
+			name:    "forward",
+			aliases: []string{"fwd"},
+			args: []argument{
+				{name: "seconds", kind: argDuration, optional: true, help: fmt.Sprintf("seconds or a duration like 30s, 1 second by default, at most %s", time.Duration(maxAmount)*time.Second), max: maxAmount},
+			},
+			states: []string{"running"},
+			help:   "roll the Scheduler forward, e.g. forward 30 or forward30",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return schedulerResult(srv.sch.Forward(amount(req)))
+			},
+		},
+		&command{
+			name: "status",
+			args: []argument{
+				{name: "events", kind: argCount, optional: true, help: fmt.Sprintf("number of upcoming events to list, %d by default, at most %d", defaultNextEvents, maxEvents), max: maxEvents},
+			},
+			help: "show the state of the Scheduler and the Server with the next events",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return srv.status(req)
+			},
+		},
+		&command{
+			name: "timeline",
+			args: []argument{
+				{name: "from", kind: argClock, optional: true, help: "game clock where the listing starts (e.g. -1:00 or 10:00), the start of the countdown by default"},
+				{name: "to", kind: argClock, optional: true, help: "game clock where the listing ends, the end of the match by default"},
+			},
+			help: "list the computed timeline",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return srv.timeline(req)
+			},
+		},
+		&command{
+			name: "watch",
+			args: []argument{
+				{name: "ticks", kind: argSwitch, optional: true, help: "stream the game clock every second too"},
+			},
+			stream: true,
+			help:   "keep the connection open and stream a line for every event of the Scheduler",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return result{message: "Watching the Scheduler until the connection is closed", watch: true, ticks: req.Ticks}, nil
+			},
+		},
+		&command{
+			name:   "session",
+			stream: true,
+			hidden: true,
+			help:   "keep the connection open and execute the following requests on it, one response each",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return result{message: "Session started, send one request per line", session: true}, nil
+			},
+		},
+		&command{
+			name: "sounds",
+			help: "list every resolvable sound with its source and duration",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return srv.sounds()
+			},
+		},
+		&command{
+			name: "play",
+			args: []argument{
+				{name: "sound name", kind: argName, help: "name of a loaded or resolvable sound, e.g. bounty_runes_appeared or tone:880hz:200ms"},
+			},
+			help: "play a sound",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return srv.playSound(req.Name)
+			},
+		},
+		&command{
+			name: "preview",
+			args: []argument{
+				{name: "event name", kind: argName, help: "name of an Event of the profile (case-insensitive), e.g. Bounty Runes"},
+			},
+			help: "play the sound effect of an Event",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				soundEffect, ok := srv.sch.EventSoundEffect(req.Name)
+				if !ok {
+					return result{}, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Unknown event: %s", req.Name)
+				}
+				return srv.playSound(soundEffect)
+			},
+		},
+		&command{
+			name: "test",
+			help: "play a sound to test the sound output",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				log.Debug("Testing Sound Output")
+				if _, err := srv.fx.PlaySound(sound.ChaosDunk); err != nil {
+					return result{}, model.NewProtocolError(model.ErrorCodeSoundError, "Test failed: %s", err)
+				}
+				return result{message: "Test succeeded"}, nil
+			},
+		},
+		&command{
+			name: "test-all",
+			help: "play every sound effect of the profile in timeline order, in the background",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return srv.testAll()
+			},
+		},
+		&command{
+			name: "metrics",
+			help: "show how the sound cues were delivered to the speaker",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return srv.metrics(), nil
+			},
+		},
+		&command{
+			name:    "help",
+			aliases: []string{"?"},
+			args: []argument{
+				{name: "command", kind: argName, optional: true, help: "name of a command to show the details of"},
+			},
+			help: "list the commands, or show the details of a command",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				message, protoErr := srv.commands.help(req.Name)
+				if protoErr != nil {
+					return result{}, protoErr
+				}
+				if cmd, ok := srv.commands.lookup(req.Name); ok {
+					return result{message: message, commands: []model.CommandInfo{cmd.info()}}, nil
+				}
+				return result{message: message, commands: srv.commands.infos()}, nil
+			},
+		},
+		&command{
+			name: "shutdown",
+			help: "shut down the Server",
+			run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+				return result{message: "DotkaFX Server is shutting down", shutdown: true}, nil
+			},
+		},
+	)
+}
+
+// schedulerResult converts the outcome of a Scheduler command into a result.
+func schedulerResult(message string, err error) (result, *model.ProtocolError) {
+	if err != nil {
+		return result{}, schedulerError(err)
+	}
+	return result{message: message}, nil
+}
+
+// execute runs the command of the Request, regardless of the protocol it was received on. The stream commands
+// are refused within a session, since the session already keeps the connection to itself.
+func (srv *Server) execute(req model.Request, inSession bool) (result, *model.ProtocolError) {
+	cmd, ok := srv.commands.lookup(req.Command)
+	if !ok {
+		return result{}, srv.commands.unknown(req.Command)
+	}
+
+	if inSession && cmd.stream {
+		return result{}, model.NewProtocolError(model.ErrorCodeInvalidArgument, "The %s command cannot be used within a session", cmd.name)
+	}
+
+	if protoErr := cmd.check(req); protoErr != nil {
+		return result{}, protoErr
+	}
+
+	if state, _ := srv.sch.Status(); !cmd.allowedIn(state) {
+		return result{}, model.NewProtocolError(model.ErrorCodeInvalidState,
+			"The %s command cannot be used while the Scheduler is %s, it has to be %s", cmd.name, state, strings.Join(cmd.states, " or "))
+	}
+
+	return cmd.run(srv, req)
+}
+
+// playSound plays any loaded or resolvable sound.
+func (srv *Server) playSound(name string) (result, *model.ProtocolError) {
+	if name == "" {
+		return result{}, model.NewProtocolError(model.ErrorCodeInvalidArgument, "The name of the sound is missing")
+	}
+	duration, err := srv.fx.PlaySound(name)
+	if err != nil {
+		return result{}, model.NewProtocolError(model.ErrorCodeSoundError, "Failed to play sound %s: %s", name, err)
+	}
+	return result{message: fmt.Sprintf("Playing %s (%.1fs)", name, duration.Seconds())}, nil
+}
+
+// testAll starts playing every sound used by the Profile in timeline order in the background, waiting for each
+// one to finish, and reports the sounds which are not loaded. The playing stops when the Server shuts down.
+func (srv *Server) testAll() (result, *model.ProtocolError) {
+	srv.mu.Lock()
+	if srv.testingSounds {
+		srv.mu.Unlock()
+		return result{}, model.NewProtocolError(model.ErrorCodeInvalidState, "The sounds of the previous test-all command are still playing")
+	}
+	srv.testingSounds = true
+	ctx := srv.ctx
+	srv.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	durations := srv.fx.Durations()
+	played, failed := []string{}, []string{}
+	for _, soundEffect := range srv.sch.SoundEffects() {
+		if _, ok := durations[soundEffect]; !ok {
+			log.Error("Sound %s is not loaded", soundEffect)
+			failed = append(failed, soundEffect)
+			continue
+		}
+		played = append(played, soundEffect)
+	}
+
+	go func() {
+		defer func() {
+			srv.mu.Lock()
+			srv.testingSounds = false
+			srv.mu.Unlock()
+		}()
+		for _, soundEffect := range played {
+			srv.fx.Play(soundEffect)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(durations[soundEffect] + testAllGap):
+			}
+		}
+	}()
+
+	message := fmt.Sprintf("Playing %d sounds", len(played))
+	if len(played) > 0 {
+		message += ": " + strings.Join(played, ", ")
+	}
+	if len(failed) > 0 {
+		message += fmt.Sprintf(", %d sounds are not loaded: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return result{message: message}, nil
+}
+
+// sounds lists every resolvable sound name with its source and duration, one sound per line.
+func (srv *Server) sounds() (result, *model.ProtocolError) {
+	catalog, err := srv.fx.Catalog()
+	if err != nil {
+		return result{}, model.NewProtocolError(model.ErrorCodeSoundError, "Failed to list sounds: %s", err)
+	}
+
+	lines := []string{}
+	for _, info := range catalog {
+		lines = append(lines, fmt.Sprintf("%s (%.1fs) %s", info.Name, float64(info.Duration)/1000, info.Source))
+	}
+
+	return result{message: strings.Join(lines, "\n"), sounds: catalog}, nil
+}
+
+// metrics reports how the sound cues of the Scheduler were delivered to the speaker.
+func (srv *Server) metrics() result {
+	cues := srv.cues.Metrics()
+	message := fmt.Sprintf("Sound cues: %d played, %d late (over %s), %d skipped, %d dropped, %d/%d queued, max delay %s",
+		cues.Played, cues.Late, time.Duration(cues.LateThreshold)*time.Millisecond, cues.Skipped, cues.Dropped,
+		cues.Queued, cues.Capacity, time.Duration(cues.MaxDelay)*time.Millisecond)
+	return result{message: message, cues: &cues}
+}
+
+// status reports the state of the Scheduler, the Profile, the uptime of the Server and the next events
+// with the time remaining until them.
+func (srv *Server) status(req model.Request) (result, *model.ProtocolError) {
+	n := req.Events
+	if n == 0 {
+		n = defaultNextEvents
+	}
+
+	profile := srv.sch.Profile()
+	uptime := time.Since(srv.startedAt).Round(time.Second)
+	status := model.ServerStatus{
+		Profile:    profile.Name,
+		ConfigFile: profile.ConfigFile,
+		StartedAt:  srv.startedAt,
+		Uptime:     uptime.Milliseconds(),
+	}
+
+	configFile := status.ConfigFile
+	if configFile == "" {
+		configFile = "embedded default config"
+	}
+
+	state, gameTime := srv.sch.Status()
+	lines := []string{
+		fmt.Sprintf("Scheduler is %s GameTime: %s", state, tools.SecondsToString(gameTime)),
+		fmt.Sprintf("Profile: %s Config: %s", status.Profile, configFile),
+		fmt.Sprintf("Uptime: %s", uptime),
+	}
+
+	nextEvents := srv.upcomingEvents(n, gameTime)
+	if len(nextEvents) == 0 {
+		lines = append(lines, "No more events on the timeline")
+	} else {
+		lines = append(lines, "Next events:")
+		for _, event := range nextEvents {
+			lines = append(lines, fmt.Sprintf("  %s %s in %s", event.GameClock, event.Name, time.Duration(event.In)*time.Second))
+		}
+	}
+
+	return result{message: strings.Join(lines, "\n"), status: &status}, nil
+}
+
+// timeline lists the occurrences of the computed timeline between the from and to game clocks of the Request,
+// by default the whole timeline.
+func (srv *Server) timeline(req model.Request) (result, *model.ProtocolError) {
+	// the match length is counted from the start of the countdown
+	profile := srv.sch.Profile()
+	from, to := -profile.Countdown, profile.MatchLength-profile.Countdown
+
+	if req.From != "" {
+		seconds, err := tools.ClockToSeconds(req.From)
+		if err != nil {
+			return result{}, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Invalid game clock: %s", req.From)
+		}
+		from = seconds
+	}
+	if req.To != "" {
+		seconds, err := tools.ClockToSeconds(req.To)
+		if err != nil {
+			return result{}, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Invalid game clock: %s", req.To)
+		}
+		to = seconds
+	}
+	if from > to {
+		return result{}, model.NewProtocolError(model.ErrorCodeInvalidArgument,
+			"The start of the timeline window (%s) is after its end (%s)", tools.SecondsToString(from), tools.SecondsToString(to))
+	}
+
+	entries := timelineEntries(srv.sch.TimelineWindow(from, to))
+
+	noun := "events"
+	if len(entries) == 1 {
+		noun = "event"
+	}
+	lines := []string{fmt.Sprintf("Timeline from %s to %s: %d %s", tools.SecondsToString(from), tools.SecondsToString(to), len(entries), noun)}
+	for _, entry := range entries {
+		line := fmt.Sprintf("  %s %s (%s)", entry.GameClock, entry.Name, entry.SoundEffect)
+		if entry.Shift != 0 {
+			line += fmt.Sprintf(" shifted %+ds", entry.Shift)
+		}
+		lines = append(lines, line)
+	}
+
+	return result{message: strings.Join(lines, "\n"), timeline: entries}, nil
+}
+
+// timelineEntries converts the events of the Scheduler into the TimelineEntries of the protocol.
+func timelineEntries(events []scheduler.TimelineEvent) []model.TimelineEntry {
+	entries := []model.TimelineEntry{}
+	for _, event := range events {
+		entries = append(entries, model.TimelineEntry{
+			Name:        event.Name,
+			SoundEffect: event.SoundEffect,
+			GameTime:    event.GameTime,
+			GameClock:   tools.SecondsToString(event.GameTime),
+			ClipLength:  event.ClipLength.Milliseconds(),
+			Shift:       event.Shift,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DonBattery/dotkafx/bus"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+const (
+	// cueQueueName is the name of the sound player on the Bus
+	cueQueueName = "SoundPlayer"
+	// cueQueueCapacity is the number of cues waiting to be played before the oldest ones get dropped
+	cueQueueCapacity = 16
+	// lateCueThreshold is the delay after which a cue is counted as late
+	lateCueThreshold = 500 * time.Millisecond
+	// staleCueThreshold is the delay after which a cue is not played at all, since it would announce
+	// something that has already happened
+	staleCueThreshold = 3 * time.Second
+)
+
+// cuePlayer plays a sound by its name. It is implemented by *sound.Player.
+type cuePlayer interface {
+	Play(name string)
+}
+
+// cueQueue is the bounded queue between the Scheduler and the speaker. The Scheduler publishes its Notifications
+// without ever blocking, the queue keeps at most cueQueueCapacity of them (dropping the oldest ones) and a single
+// goroutine plays their sounds in order, so a slow speaker never holds up the Scheduler.
+type cueQueue struct {
+	fx            cuePlayer
+	bus           *bus.Bus
+	notifications <-chan model.Notification
+	unsubscribe   func()
+
+	played   int
+	late     int
+	skipped  int
+	maxDelay time.Duration
+	mu       sync.Mutex
+}
+
+// newCueQueue subscribes to the Bus. Only the Notifications with a sound are queued, so the ticks never push out
+// the cues. The cues are only played once run is called.
+func newCueQueue(fx cuePlayer, b *bus.Bus, capacity int) *cueQueue {
+	notifications, unsubscribe := b.SubscribeFiltered(cueQueueName, capacity, bus.DropOldest, hasCue)
+	return &cueQueue{
+		fx:            fx,
+		bus:           b,
+		notifications: notifications,
+		unsubscribe:   unsubscribe,
+	}
+}
+
+// hasCue tells whether the Notification has a sound to be played.
+func hasCue(notification model.Notification) bool {
+	_, ok := sound.NotificationSound(notification)
+	return ok
+}
+
+// run plays the sound of every queued Notification until the queue is closed or the context is done.
+func (cq *cueQueue) run(ctx context.Context) {
+	for {
+		var notification model.Notification
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-cq.notifications:
+			if !ok {
+				return
+			}
+			notification = n
+		}
+
+		name, ok := sound.NotificationSound(notification)
+		if !ok {
+			continue
+		}
+		if !cq.due(notification, name) {
+			continue
+		}
+		cq.fx.Play(name)
+	}
+}
+
+// due records the delay of the cue and tells whether it is still worth playing.
+func (cq *cueQueue) due(notification model.Notification, name string) bool {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	var delay time.Duration
+	if !notification.Time.IsZero() {
+		delay = time.Since(notification.Time)
+	}
+	if delay > cq.maxDelay {
+		cq.maxDelay = delay
+	}
+
+	if delay > staleCueThreshold {
+		cq.skipped++
+		log.Warn("Skipped sound %s of %s Notification, it is %s late", name, notification.Kind, delay.Round(time.Millisecond))
+		return false
+	}
+	if delay > lateCueThreshold {
+		cq.late++
+		log.Warn("Playing sound %s of %s Notification %s late", name, notification.Kind, delay.Round(time.Millisecond))
+	}
+	cq.played++
+	return true
+}
+
+// close unsubscribes from the Bus, which stops run.
+func (cq *cueQueue) close() {
+	cq.unsubscribe()
+}
+
+// Metrics returns the delivery statistics of the queue.
+func (cq *cueQueue) Metrics() model.CueMetrics {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	return model.CueMetrics{
+		Queued:        len(cq.notifications),
+		Capacity:      cap(cq.notifications),
+		Played:        cq.played,
+		Dropped:       cq.bus.Dropped()[cueQueueName],
+		Late:          cq.late,
+		Skipped:       cq.skipped,
+		MaxDelay:      cq.maxDelay.Milliseconds(),
+		LateThreshold: lateCueThreshold.Milliseconds(),
+	}
+}
@@ -0,0 +1,15 @@
+package server
+
+import "github.com/DonBattery/dotkafx/model"
+
+// AddPanicCommand registers a panic command which panics while it is executed, so the recovery of the Server
+// can be tested.
+func (srv *Server) AddPanicCommand() {
+	srv.commands = newRegistry(append(srv.commands.commands, &command{
+		name: "panic",
+		help: "panic while the command is executed",
+		run: func(srv *Server, req model.Request) (result, *model.ProtocolError) {
+			panic("panic command")
+		},
+	})...)
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/tools"
+)
+
+const (
+	apiPrefix             = "/api/v1/"
+	overlayPrefix         = "/overlay/"
+	embeddedOverlayFolder = "embedded_overlay"
+	// commandHeader marks a POST request as sent by a client of the API, instead of a JSON Content-Type
+	commandHeader = "X-DotkaFX-Request"
+)
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+// httpStatus maps the error codes of the protocol to HTTP status codes.
+func httpStatus(protoErr *model.ProtocolError) int {
+	if protoErr == nil {
+		return http.StatusOK
+	}
+	switch protoErr.Code {
+	case model.ErrorCodeBadRequest, model.ErrorCodeInvalidArgument, model.ErrorCodeUnsupportedVersion:
+		return http.StatusBadRequest
+	case model.ErrorCodeUnknownCommand:
+		return http.StatusNotFound
+	case model.ErrorCodeInvalidState:
+		return http.StatusConflict
+	case model.ErrorCodeUnauthorized:
+		return http.StatusUnauthorized
+	case model.ErrorCodeBusy:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSON encodes the body as the JSON response of the HTTP request.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error("Failed to write HTTP response: %s", err)
+	}
+}
+
+// writeError responds with a protocol Response carrying only the error and the state of the Scheduler.
+func (srv *Server) writeError(w http.ResponseWriter, protoErr *model.ProtocolError) {
+	writeJSON(w, httpStatus(protoErr), srv.response(model.Request{}, result{}, protoErr))
+}
+
+// allowMethod responds with 405 if the method of the HTTP request is not the allowed one.
+func (srv *Server) allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeJSON(w, http.StatusMethodNotAllowed, srv.response(model.Request{}, result{},
+		model.NewProtocolError(model.ErrorCodeBadRequest, "Method %s is not allowed on %s", r.Method, r.URL.Path)))
+	return false
+}
+
+// intQuery returns the integer value of a query parameter, or the fallback if it is not set.
+func intQuery(r *http.Request, key string, fallback int) (int, *model.ProtocolError) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Invalid value for %s: %s", key, value)
+	}
+	return n, nil
+}
+
+// secondsQuery returns the value of a duration query parameter (e.g. "90" or "1m30s") in seconds, or 0 if it is not set.
+func secondsQuery(r *http.Request, key string) (int, *model.ProtocolError) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := tools.StringToSeconds(value)
+	if err != nil {
+		return 0, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Invalid value for %s: %s", key, err)
+	}
+	return seconds, nil
+}
+
+// loopbackListen tells if the Server only accepts connections from the local machine.
+func (srv *Server) loopbackListen() bool {
+	if strings.EqualFold(srv.cmd.Listen, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(srv.cmd.Listen)
+	return ip != nil && ip.IsLoopback()
+}
+
+// allowHost tells if the Host of an HTTP request is the Server itself. A web page can point its own domain name
+// to 127.0.0.1 (DNS rebinding) to read the API or send commands to it, so the host has to be localhost or
+// a loopback address, or any IP address if the Server accepts connections from other machines.
+func (srv *Server) allowHost(host string) bool {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || !srv.loopbackListen())
+}
+
+// guard rejects the HTTP requests to a foreign host, and the requests of web pages other than the overlay.
+func (srv *Server) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var protoErr *model.ProtocolError
+		if !srv.allowHost(r.Host) {
+			protoErr = model.NewProtocolError(model.ErrorCodeUnauthorized, "Host %s is not allowed", r.Host)
+		} else if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+			protoErr = model.NewProtocolError(model.ErrorCodeUnauthorized, "Origin %s is not allowed", origin)
+		}
+		if protoErr != nil {
+			log.Warn("Rejected HTTP request from %s: %s", r.RemoteAddr, protoErr.Message)
+			writeJSON(w, http.StatusForbidden, srv.response(model.Request{}, result{}, protoErr))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// commandRequest tells if a POST request is sent by a client of the API: a web page can only send a simple form
+// without asking the Server first, which has neither a JSON Content-Type nor a custom header.
+func commandRequest(r *http.Request) bool {
+	if r.Header.Get(commandHeader) != "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// HTTPHandler returns the handler of the HTTP API. The POST endpoints execute the same commands
+// as the TCP protocol, and respond with the same Response object. If the Server is run with a token,
+// the POST endpoints require it in the Authorization header as a Bearer token. Only the requests to the Server
+// itself (localhost) are served, and the only web page allowed to use the API is the overlay of the Server.
+func (srv *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(apiPrefix+"openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		if _, err := w.Write(openAPI); err != nil {
+			log.Error("Failed to write HTTP response: %s", err)
+		}
+	})
+
+	mux.HandleFunc(apiPrefix+"state", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		events, protoErr := intQuery(r, "events", defaultNextEvents)
+		if protoErr != nil {
+			srv.writeError(w, protoErr)
+			return
+		}
+		writeJSON(w, http.StatusOK, srv.response(model.Request{Events: events}, result{}, nil))
+	})
+
+	mux.HandleFunc(apiPrefix+"time", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		state, gameTime := srv.sch.Status()
+		writeJSON(w, http.StatusOK, model.Clock{
+			State:     state,
+			GameTime:  gameTime,
+			GameClock: tools.SecondsToString(gameTime),
+		})
+	})
+
+	mux.HandleFunc(apiPrefix+"timeline", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		res, protoErr := srv.timeline(model.Request{
+			From: r.URL.Query().Get("from"),
+			To:   r.URL.Query().Get("to"),
+		})
+		if protoErr != nil {
+			srv.writeError(w, protoErr)
+			return
+		}
+		writeJSON(w, http.StatusOK, res.timeline)
+	})
+
+	mux.HandleFunc(apiPrefix+"status", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		events, protoErr := intQuery(r, "events", defaultNextEvents)
+		if protoErr != nil {
+			srv.writeError(w, protoErr)
+			return
+		}
+		req := model.Request{Command: "status", Events: events}
+		res, protoErr := srv.status(req)
+		writeJSON(w, httpStatus(protoErr), srv.response(req, res, protoErr))
+	})
+
+	mux.HandleFunc(apiPrefix+"events", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		n, protoErr := intQuery(r, "n", defaultNextEvents)
+		if protoErr != nil {
+			srv.writeError(w, protoErr)
+			return
+		}
+		_, gameTime := srv.sch.Status()
+		writeJSON(w, http.StatusOK, srv.upcomingEvents(n, gameTime))
+	})
+
+	mux.HandleFunc(apiPrefix+"metrics", func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, srv.cues.Metrics())
+	})
+
+	mux.HandleFunc(apiPrefix+"stream", srv.handleStream)
+
+	overlay, err := fs.Sub(srv.overlay, embeddedOverlayFolder)
+	if err != nil {
+		log.Error("Failed to open the embedded overlay: %s", err)
+	} else {
+		mux.Handle(overlayPrefix, http.StripPrefix(overlayPrefix, http.FileServer(http.FS(overlay))))
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/" {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, overlayPrefix, http.StatusFound)
+		})
+	}
+
+	for _, command := range []string{"start", "stop", "pause", "back", "forward", "shutdown"} {
+		command := command
+		mux.HandleFunc(apiPrefix+command, func(w http.ResponseWriter, r *http.Request) {
+			if !srv.allowMethod(w, r, http.MethodPost) {
+				return
+			}
+			srv.handleHTTPCommand(w, r, command)
+		})
+	}
+
+	return srv.guard(mux)
+}
+
+// handleHTTPCommand executes a command received on the HTTP API. The amount of the back and forward commands
+// is read from the "seconds" query parameter.
+func (srv *Server) handleHTTPCommand(w http.ResponseWriter, r *http.Request, command string) {
+	req := model.Request{
+		Version: model.ProtocolVersion,
+		Command: command,
+	}
+
+	seconds, protoErr := secondsQuery(r, "seconds")
+	if protoErr != nil {
+		srv.writeError(w, protoErr)
+		return
+	}
+	req.Seconds = seconds
+
+	events, protoErr := intQuery(r, "events", defaultNextEvents)
+	if protoErr != nil {
+		srv.writeError(w, protoErr)
+		return
+	}
+	req.Events = events
+
+	log.Info("HTTP request received: %s %s", r.Method, r.URL)
+
+	if !commandRequest(r) {
+		srv.writeError(w, model.NewProtocolError(model.ErrorCodeBadRequest,
+			"The commands need the Content-Type: application/json or the %s header", commandHeader))
+		return
+	}
+
+	if protoErr := srv.authorize(bearerToken(r), r.RemoteAddr); protoErr != nil {
+		srv.writeError(w, protoErr)
+		return
+	}
+
+	res, protoErr := srv.execute(req, false)
+	writeJSON(w, httpStatus(protoErr), srv.response(req, res, protoErr))
+
+	if res.shutdown {
+		// let the response reach the client before the Server exits
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		srv.stop()
+	}
+}
@@ -0,0 +1,424 @@
+package server_test
+
+import (
+	"bufio"
+	"embed"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+//go:embed testdata/embedded_overlay
+var testOverlay embed.FS
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return newTestServerWithCommand(t, model.RootCommand{})
+}
+
+func newTestServerWithCommand(t *testing.T, cmd model.RootCommand) *httptest.Server {
+	return newTestServerWith(t, newTestScheduler(), cmd, embed.FS{})
+}
+
+func newTestScheduler() *scheduler.Scheduler {
+	profile := model.ConfigProfile{
+		Name:        "test",
+		ConfigFile:  "test_config.yml",
+		Countdown:   60,
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			"Bounty Runes": {FirstHappensAt: 180, Interval: 180, SoundEffect: "bounty_runes_appeared"},
+			"Power Rune":   {FirstHappensAt: 360, Interval: 120, SoundEffect: "power_rune_appeared"},
+		},
+	}
+	return scheduler.NewScheduler(profile, nil)
+}
+
+func newTestServerWith(t *testing.T, sch *scheduler.Scheduler, cmd model.RootCommand, overlay fs.FS) *httptest.Server {
+	srv := server.NewServer(sound.NewPlayer(embed.FS{}, nil), sch, cmd, overlay)
+	ts := httptest.NewServer(srv.HTTPHandler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doRequest(t *testing.T, method string, url string, body any) int {
+	return doRequestWithToken(t, method, url, "", body)
+}
+
+func doRequestWithToken(t *testing.T, method string, url string, token string, body any) int {
+	headers := map[string]string{}
+	if method == http.MethodPost {
+		headers["Content-Type"] = "application/json"
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	return doRequestWithHeaders(t, method, url, headers, body)
+}
+
+// doRequestWithHeaders sends the HTTP request with the headers, the "Host" header sets the host of the request.
+func doRequestWithHeaders(t *testing.T, method string, url string, headers map[string]string, body any) int {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		if key == "Host" {
+			req.Host = value
+		} else {
+			req.Header.Set(key, value)
+		}
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body != nil {
+		if err := json.NewDecoder(res.Body).Decode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestHTTPCommands(t *testing.T) {
+	require := assert.New(t)
+	ts := newTestServer(t)
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		requiredStatus int
+		requiredState  string
+		requiredError  string
+	}{
+		{"initialState", http.MethodGet, "/api/v1/state", http.StatusOK, "stopped", ""},
+		{"stopWhenStopped", http.MethodPost, "/api/v1/stop", http.StatusConflict, "stopped", model.ErrorCodeInvalidState},
+		{"backWhenStopped", http.MethodPost, "/api/v1/back?seconds=5", http.StatusConflict, "stopped", model.ErrorCodeInvalidState},
+		{"start", http.MethodPost, "/api/v1/start", http.StatusOK, "running", ""},
+		{"startWithGet", http.MethodGet, "/api/v1/start", http.StatusMethodNotAllowed, "running", model.ErrorCodeBadRequest},
+		{"forward", http.MethodPost, "/api/v1/forward?seconds=5m", http.StatusOK, "running", ""},
+		{"forwardTooMuch", http.MethodPost, "/api/v1/forward?seconds=1h", http.StatusBadRequest, "running", model.ErrorCodeInvalidArgument},
+		{"backInvalid", http.MethodPost, "/api/v1/back?seconds=abc", http.StatusBadRequest, "running", model.ErrorCodeInvalidArgument},
+		{"pause", http.MethodPost, "/api/v1/pause", http.StatusOK, "paused", ""},
+		{"resume", http.MethodPost, "/api/v1/pause", http.StatusOK, "running", ""},
+		{"stop", http.MethodPost, "/api/v1/stop", http.StatusOK, "stopped", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing HTTP API, with %s", testCase.name)
+		var res model.Response
+		status := doRequest(t, testCase.method, ts.URL+testCase.path, &res)
+		require.Equal(testCase.requiredStatus, status, testCase.name)
+		require.Equal(testCase.requiredState, res.State, testCase.name)
+		if testCase.requiredError == "" {
+			require.True(res.OK, testCase.name)
+			require.Nil(res.Error, testCase.name)
+		} else {
+			require.False(res.OK, testCase.name)
+			if require.NotNil(res.Error, testCase.name) {
+				require.Equal(testCase.requiredError, res.Error.Code, testCase.name)
+			}
+		}
+	}
+}
+
+func TestHTTPQueries(t *testing.T) {
+	require := assert.New(t)
+	ts := newTestServer(t)
+
+	var clock model.Clock
+	require.Equal(http.StatusOK, doRequest(t, http.MethodGet, ts.URL+"/api/v1/time", &clock))
+	require.Equal(model.Clock{State: "stopped", GameTime: -60, GameClock: "-00:01:00"}, clock)
+
+	var events []model.UpcomingEvent
+	require.Equal(http.StatusOK, doRequest(t, http.MethodGet, ts.URL+"/api/v1/events?n=2", &events))
+	require.Equal([]model.UpcomingEvent{
+		{Name: "Bounty Runes", SoundEffect: "bounty_runes_appeared", GameTime: 180, GameClock: "00:03:00", In: 240},
+		// the Power Rune is shifted, so it does not overlap with the Bounty Runes
+		{Name: "Power Rune", SoundEffect: "power_rune_appeared", GameTime: 358, GameClock: "00:05:58", In: 418},
+	}, events)
+
+	var timeline []model.TimelineEntry
+	require.Equal(http.StatusOK, doRequest(t, http.MethodGet, ts.URL+"/api/v1/timeline", &timeline))
+	require.NotEmpty(timeline)
+	for i := 1; i < len(timeline); i++ {
+		require.LessOrEqual(timeline[i-1].GameTime, timeline[i].GameTime)
+	}
+
+	var window []model.TimelineEntry
+	require.Equal(http.StatusOK, doRequest(t, http.MethodGet, ts.URL+"/api/v1/timeline?from=3:00&to=6:00", &window))
+	if require.Len(window, 3) {
+		require.Equal(180, window[0].GameTime)
+		require.Equal("Power Rune", window[1].Name)
+		require.Equal(-2, window[1].Shift)
+		require.Equal("00:06:00", window[2].GameClock)
+	}
+
+	var status model.Response
+	require.Equal(http.StatusOK, doRequest(t, http.MethodGet, ts.URL+"/api/v1/status?events=1", &status))
+	if require.NotNil(status.Status) {
+		require.Equal("test", status.Status.Profile)
+		require.Equal("test_config.yml", status.Status.ConfigFile)
+	}
+	require.Len(status.NextEvents, 1)
+
+	var res model.Response
+	require.Equal(http.StatusBadRequest, doRequest(t, http.MethodGet, ts.URL+"/api/v1/events?n=many", &res))
+	require.Equal(model.ErrorCodeInvalidArgument, res.Error.Code)
+
+	res = model.Response{}
+	require.Equal(http.StatusBadRequest, doRequest(t, http.MethodGet, ts.URL+"/api/v1/timeline?from=6:00&to=3:00", &res))
+	require.Equal(model.ErrorCodeInvalidArgument, res.Error.Code)
+
+	openAPI, err := http.Get(ts.URL + "/api/v1/openapi.yaml")
+	if require.NoError(err) {
+		defer openAPI.Body.Close()
+		require.Equal(http.StatusOK, openAPI.StatusCode)
+		require.True(strings.HasPrefix(openAPI.Header.Get("Content-Type"), "application/yaml"))
+	}
+}
+
+func TestHTTPStream(t *testing.T) {
+	require := assert.New(t)
+	ts := newTestServer(t)
+
+	res, err := http.Get(ts.URL + "/api/v1/stream")
+	if !require.NoError(err) {
+		return
+	}
+	defer res.Body.Close()
+	require.Equal("text/event-stream", res.Header.Get("Content-Type"))
+
+	events := make(chan model.Notification)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+				var notification model.Notification
+				if err := json.Unmarshal([]byte(data), &notification); err == nil {
+					events <- notification
+				}
+			}
+		}
+	}()
+
+	next := func() model.Notification {
+		select {
+		case notification := <-events:
+			return notification
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a Server-Sent Event")
+			return model.Notification{}
+		}
+	}
+
+	snapshot := next()
+	require.False(snapshot.Time.IsZero())
+	snapshot.Time = time.Time{}
+	require.Equal(model.Notification{Kind: model.NotificationState, State: "stopped", GameTime: -60, GameClock: "-00:01:00"}, snapshot)
+
+	require.Equal(http.StatusOK, doRequest(t, http.MethodPost, ts.URL+"/api/v1/start", nil))
+	require.Equal(model.NotificationStarted, next().Kind)
+
+	require.Equal(http.StatusOK, doRequest(t, http.MethodPost, ts.URL+"/api/v1/forward?seconds=30", nil))
+	// ticks of the running clock may arrive between the other notifications
+	notification := next()
+	for notification.Kind == model.NotificationTick {
+		notification = next()
+	}
+	require.Equal(model.NotificationRolledForward, notification.Kind)
+	require.Equal(30, notification.Seconds)
+	require.Equal("running", notification.State)
+}
+
+func TestHTTPCommandsWithStalledSpeaker(t *testing.T) {
+	require := assert.New(t)
+	// the Server is not running, so nothing plays the cues and the queue fills up
+	sch := newTestScheduler()
+	ts := newTestServerWith(t, sch, model.RootCommand{}, embed.FS{})
+
+	paths := []string{"/api/v1/start", "/api/v1/pause", "/api/v1/forward?seconds=30", "/api/v1/back?seconds=5", "/api/v1/stop"}
+
+	// every successful command publishes exactly one cue, while the ticks flood the Bus without a cue
+	const workers, iterations = 8, 20
+	var wg sync.WaitGroup
+	var cues int64
+	done := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				path := paths[(w+i)%len(paths)]
+				method := http.MethodPost
+				if i%3 == 0 {
+					method, path = http.MethodGet, "/api/v1/state"
+				}
+				sch.Bus.Publish(model.Notification{Kind: model.NotificationTick})
+				if doRequest(t, method, ts.URL+path, nil) == http.StatusOK && method == http.MethodPost {
+					atomic.AddInt64(&cues, 1)
+				}
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("The commands were blocked by the stalled speaker")
+	}
+
+	var metrics model.CueMetrics
+	require.Equal(http.StatusOK, doRequest(t, http.MethodGet, ts.URL+"/api/v1/metrics", &metrics))
+	require.Equal(metrics.Capacity, metrics.Queued)
+	require.Greater(metrics.Dropped, 0)
+	// only the cues are queued and dropped, the ticks are not
+	require.Equal(int(cues), metrics.Queued+metrics.Dropped)
+	require.Equal(0, metrics.Played)
+	require.Equal(int64(500), metrics.LateThreshold)
+}
+
+func TestHTTPAuthorization(t *testing.T) {
+	require := assert.New(t)
+	ts := newTestServerWithCommand(t, model.RootCommand{Token: "secret"})
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		token          string
+		requiredStatus int
+		requiredState  string
+		requiredError  string
+	}{
+		{"withoutToken", http.MethodPost, "/api/v1/start", "", http.StatusUnauthorized, "stopped", model.ErrorCodeUnauthorized},
+		{"withInvalidToken", http.MethodPost, "/api/v1/start", "wrong", http.StatusUnauthorized, "stopped", model.ErrorCodeUnauthorized},
+		{"shutdownWithoutToken", http.MethodPost, "/api/v1/shutdown", "", http.StatusUnauthorized, "stopped", model.ErrorCodeUnauthorized},
+		{"withToken", http.MethodPost, "/api/v1/start", "secret", http.StatusOK, "running", ""},
+		{"queryWithoutToken", http.MethodGet, "/api/v1/state", "", http.StatusOK, "running", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing HTTP authorization, with %s", testCase.name)
+		var res model.Response
+		require.Equal(testCase.requiredStatus, doRequestWithToken(t, testCase.method, ts.URL+testCase.path, testCase.token, &res), testCase.name)
+		require.Equal(testCase.requiredState, res.State, testCase.name)
+		if testCase.requiredError == "" {
+			require.Nil(res.Error, testCase.name)
+		} else if require.NotNil(res.Error, testCase.name) {
+			require.Equal(testCase.requiredError, res.Error.Code, testCase.name)
+		}
+	}
+}
+
+func TestHTTPForeignRequests(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := []struct {
+		name           string
+		listen         string
+		method         string
+		path           string
+		headers        map[string]string
+		requiredStatus int
+		requiredError  string
+	}{
+		{"sameOrigin", "127.0.0.1", http.MethodGet, "/api/v1/state", map[string]string{}, http.StatusOK, ""},
+		{"localhost", "127.0.0.1", http.MethodGet, "/api/v1/state", map[string]string{"Host": "localhost:38384"}, http.StatusOK, ""},
+		{"foreignHost", "127.0.0.1", http.MethodGet, "/api/v1/state", map[string]string{"Host": "evil.example"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"foreignHostStream", "127.0.0.1", http.MethodGet, "/api/v1/stream", map[string]string{"Host": "evil.example:38384"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"foreignHostCommand", "127.0.0.1", http.MethodPost, "/api/v1/start",
+			map[string]string{"Host": "evil.example", "Content-Type": "application/json"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"networkAddress", "127.0.0.1", http.MethodGet, "/api/v1/state", map[string]string{"Host": "192.168.1.2:38384"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"networkAddressOnAllInterfaces", "0.0.0.0", http.MethodGet, "/api/v1/state", map[string]string{"Host": "192.168.1.2:38384"}, http.StatusOK, ""},
+		{"foreignHostOnAllInterfaces", "0.0.0.0", http.MethodGet, "/api/v1/state", map[string]string{"Host": "evil.example"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"crossOriginQuery", "127.0.0.1", http.MethodGet, "/api/v1/timeline", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"crossOriginCommand", "127.0.0.1", http.MethodPost, "/api/v1/start",
+			map[string]string{"Origin": "http://evil.example", "Content-Type": "application/json"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"nullOriginCommand", "127.0.0.1", http.MethodPost, "/api/v1/start",
+			map[string]string{"Origin": "null", "X-DotkaFX-Request": "1"}, http.StatusForbidden, model.ErrorCodeUnauthorized},
+		{"formCommand", "127.0.0.1", http.MethodPost, "/api/v1/start",
+			map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusBadRequest, model.ErrorCodeBadRequest},
+		{"plainCommand", "127.0.0.1", http.MethodPost, "/api/v1/shutdown", map[string]string{}, http.StatusBadRequest, model.ErrorCodeBadRequest},
+		{"jsonCommand", "127.0.0.1", http.MethodPost, "/api/v1/start",
+			map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusOK, ""},
+		{"customHeaderCommand", "127.0.0.1", http.MethodPost, "/api/v1/start", map[string]string{"X-DotkaFX-Request": "1"}, http.StatusOK, ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing HTTP foreign requests, with %s", testCase.name)
+		ts := newTestServerWithCommand(t, model.RootCommand{Listen: testCase.listen})
+		if testCase.name == "sameOrigin" {
+			// the requests of the overlay carry its own origin
+			testCase.headers["Origin"] = ts.URL
+		}
+
+		var res model.Response
+		require.Equal(testCase.requiredStatus, doRequestWithHeaders(t, testCase.method, ts.URL+testCase.path, testCase.headers, &res), testCase.name)
+		if testCase.requiredError == "" {
+			require.Nil(res.Error, testCase.name)
+		} else if require.NotNil(res.Error, testCase.name) {
+			require.Equal(testCase.requiredError, res.Error.Code, testCase.name)
+			// the rejected commands are not executed
+			require.Equal("stopped", res.State, testCase.name)
+		}
+	}
+}
+
+func TestHTTPOverlay(t *testing.T) {
+	require := assert.New(t)
+	overlay, err := fs.Sub(testOverlay, "testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newTestServerWith(t, newTestScheduler(), model.RootCommand{}, overlay)
+
+	testCases := []struct {
+		name                string
+		path                string
+		requiredStatus      int
+		requiredContentType string
+		requiredBody        string
+	}{
+		{"root", "/", http.StatusOK, "text/html; charset=utf-8", "test overlay"},
+		{"index", "/overlay/", http.StatusOK, "text/html; charset=utf-8", "test overlay"},
+		{"stylesheet", "/overlay/overlay.css", http.StatusOK, "text/css; charset=utf-8", "body { color: white; }"},
+		{"missing", "/overlay/missing.js", http.StatusNotFound, "text/plain; charset=utf-8", "404 page not found"},
+		{"unknownPath", "/missing", http.StatusNotFound, "text/plain; charset=utf-8", "404 page not found"},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing HTTP overlay, with %s", testCase.name)
+		res, err := http.Get(ts.URL + testCase.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(err, testCase.name)
+		require.Equal(testCase.requiredStatus, res.StatusCode, testCase.name)
+		require.Equal(testCase.requiredContentType, res.Header.Get("Content-Type"), testCase.name)
+		require.Contains(string(body), testCase.requiredBody, testCase.name)
+	}
+}
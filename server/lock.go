@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// lockPermissions keep the lock file writable only by the user running the Server
+	lockPermissions = 0600
+	// lockWriteGrace is the age until which an unreadable lock file is taken as held, because a Server writes
+	// the content right after it creates the file
+	lockWriteGrace = 5 * time.Second
+)
+
+// AlreadyRunningError is returned by Run if another Server holds the lock file.
+type AlreadyRunningError struct {
+	Lock model.ServerLock
+	Path string
+}
+
+func (are *AlreadyRunningError) Error() string {
+	if are.Lock.PID == 0 {
+		return fmt.Sprintf("DotkaFX Server is starting (its lock file %s is not written yet), remove it if it is not",
+			are.Path)
+	}
+	where := fmt.Sprintf("port %d", are.Lock.Port)
+	if are.Lock.Port == 0 {
+		where = "socket " + are.Lock.Socket
+	}
+	return fmt.Sprintf("DotkaFX Server is already running (pid %d, %s), remove %s if it is not",
+		are.Lock.PID, where, are.Path)
+}
+
+// serverLock is the lock file held by a running Server.
+type serverLock struct {
+	path string
+	lock model.ServerLock
+}
+
+// acquireLock creates the lock file. If the file exists but its Server is not running anymore (e.g. it crashed),
+// the stale file is reclaimed. An unreadable file is only reclaimed once it is older than lockWriteGrace, until
+// then another Server may be writing it.
+func acquireLock(path string) (*serverLock, error) {
+	sl := &serverLock{
+		path: path,
+		lock: model.ServerLock{PID: os.Getpid(), StartedAt: time.Now()},
+	}
+
+	// the second attempt is made after a stale lock file is removed
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, lockPermissions)
+		if err == nil {
+			return sl, sl.create(file)
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		existing, err := model.ReadServerLock(path)
+		switch {
+		case err == nil && existing.PID != os.Getpid() && processAlive(existing.PID):
+			return nil, &AlreadyRunningError{Lock: existing, Path: path}
+		case err != nil && recentlyModified(path):
+			return nil, &AlreadyRunningError{Path: path}
+		}
+		log.Warn("Reclaiming the stale lock file %s", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("Failed to acquire the lock file %s", path)
+}
+
+// create writes the content of the lock file through the handle of the file just created, and closes it.
+// If the content cannot be written, the file is removed.
+func (sl *serverLock) create(file *os.File) error {
+	data, err := json.Marshal(sl.lock)
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(sl.path)
+	}
+	return err
+}
+
+// recentlyModified tells whether the file was modified within lockWriteGrace.
+func recentlyModified(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) < lockWriteGrace
+}
+
+// update records where the Server listens.
+func (sl *serverLock) update(port int, socket string) error {
+	sl.lock.Port = port
+	sl.lock.Socket = socket
+	return sl.write()
+}
+
+// write writes the content of the lock file.
+func (sl *serverLock) write() error {
+	data, err := json.Marshal(sl.lock)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sl.path, data, lockPermissions)
+}
+
+// release removes the lock file, unless another Server has reclaimed it in the meantime.
+func (sl *serverLock) release() {
+	if existing, err := model.ReadServerLock(sl.path); err != nil || existing.PID != sl.lock.PID {
+		return
+	}
+	if err := os.Remove(sl.path); err != nil {
+		log.Error("Failed to remove the lock file %s: %s", sl.path, err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive tells whether a process with the pid is running. The signal 0 only checks the process,
+// EPERM means that it runs as another user.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package server
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a process which has not exited yet (STILL_ACTIVE)
+const stillActive = 259
+
+// processAlive tells whether a process with the pid is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// access denied means that the process exists but runs as another user
+		return err == windows.ERROR_ACCESS_DENIED
+	}
+	defer windows.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := windows.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
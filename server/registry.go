@@ -0,0 +1,369 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/tools"
+)
+
+// argKind is the type of a command argument. It tells how the argument of a text command is parsed
+// and which field of the Request it is stored in.
+type argKind int
+
+const (
+	// argDuration is a number of seconds or a duration like 1m24s, stored in Request.Seconds
+	argDuration argKind = iota
+	// argName is the rest of the command line (it may contain spaces), stored in Request.Name
+	argName
+	// argClock is a game clock like -1:00 or 12:30, the first one is stored in Request.From, the second one in Request.To
+	argClock
+	// argCount is a positive integer, stored in Request.Events
+	argCount
+	// argSwitch is the name of the argument itself, which turns an option on, stored in Request.Ticks
+	argSwitch
+)
+
+func (ak argKind) String() string {
+	switch ak {
+	case argDuration:
+		return "duration"
+	case argName:
+		return "name"
+	case argClock:
+		return "game clock"
+	case argCount:
+		return "number"
+	case argSwitch:
+		return "switch"
+	default:
+		return "unknown"
+	}
+}
+
+// argument is an argument of a command.
+type argument struct {
+	name     string
+	kind     argKind
+	optional bool
+	help     string
+	// max is the largest value of a duration (in seconds) or a number argument, 0 means unlimited
+	max int
+}
+
+func (arg argument) usage() string {
+	if arg.optional {
+		return "[" + arg.name + "]"
+	}
+	return "<" + arg.name + ">"
+}
+
+// parse validates the value of the argument and stores it in the Request.
+func (arg argument) parse(value string, req *model.Request) error {
+	switch arg.kind {
+	case argDuration:
+		seconds, err := tools.StringToSeconds(value)
+		if err != nil {
+			return fmt.Errorf("%s is not a duration", value)
+		}
+		if seconds < 1 {
+			return fmt.Errorf("%s is less than 1 second", value)
+		}
+		if arg.max > 0 && seconds > arg.max {
+			return fmt.Errorf("%s is more than %s", value, time.Duration(arg.max)*time.Second)
+		}
+		req.Seconds = seconds
+	case argName:
+		req.Name = value
+	case argClock:
+		if _, err := tools.ClockToSeconds(value); err != nil {
+			return fmt.Errorf("%s is not a game clock", value)
+		}
+		if req.From == "" {
+			req.From = value
+		} else {
+			req.To = value
+		}
+	case argCount:
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("%s is not a positive number", value)
+		}
+		if arg.max > 0 && n > arg.max {
+			return fmt.Errorf("%s is more than %d", value, arg.max)
+		}
+		req.Events = n
+	case argSwitch:
+		if !strings.EqualFold(value, arg.name) {
+			return fmt.Errorf("%s is not %s", value, arg.name)
+		}
+		req.Ticks = true
+	}
+	return nil
+}
+
+// command is a command of the Server. The same commands are executed on every protocol.
+type command struct {
+	name    string
+	aliases []string
+	args    []argument
+	// states are the states of the Scheduler the command is allowed in, empty means every state
+	states []string
+	// stream commands keep the connection open after their response, so they cannot be used within a session
+	stream bool
+	// hidden commands are used by the clients internally, they are left out of the help and the command lists
+	hidden bool
+	help   string
+	run    func(srv *Server, req model.Request) (result, *model.ProtocolError)
+}
+
+// usage returns the name of the command with its arguments (e.g. "back [seconds]").
+func (cmd *command) usage() string {
+	parts := []string{cmd.name}
+	for _, arg := range cmd.args {
+		parts = append(parts, arg.usage())
+	}
+	return strings.Join(parts, " ")
+}
+
+// info returns the description of the command with its arguments.
+func (cmd *command) info() model.CommandInfo {
+	info := model.CommandInfo{
+		Name:    cmd.name,
+		Aliases: cmd.aliases,
+		Usage:   cmd.usage(),
+		Help:    cmd.help,
+	}
+	for _, arg := range cmd.args {
+		info.Args = append(info.Args, model.ArgumentInfo{
+			Name:     arg.name,
+			Kind:     arg.kind.String(),
+			Optional: arg.optional,
+			Help:     arg.help,
+		})
+	}
+	return info
+}
+
+// invalid returns the error of an argument with an invalid value.
+func (cmd *command) invalid(arg argument, err error) *model.ProtocolError {
+	return model.NewProtocolError(model.ErrorCodeInvalidArgument, "Invalid value for %s: %s (usage: %s)", arg.usage(), err, cmd.usage())
+}
+
+// check validates the arguments stored in a Request which was not parsed from a command line (e.g. a JSON Request)
+// with the same rules as parse. The zero values are the omitted arguments.
+func (cmd *command) check(req model.Request) *model.ProtocolError {
+	clocks := []string{req.From, req.To}
+	for _, arg := range cmd.args {
+		var value string
+		switch arg.kind {
+		case argDuration:
+			if req.Seconds != 0 {
+				value = strconv.Itoa(req.Seconds)
+			}
+		case argCount:
+			if req.Events != 0 {
+				value = strconv.Itoa(req.Events)
+			}
+		case argClock:
+			value, clocks = clocks[0], clocks[1:]
+		}
+		if value == "" {
+			continue
+		}
+		if err := arg.parse(value, &model.Request{}); err != nil {
+			return cmd.invalid(arg, err)
+		}
+	}
+	return nil
+}
+
+// allowedIn tells whether the command can be executed in the given state of the Scheduler.
+func (cmd *command) allowedIn(state string) bool {
+	if len(cmd.states) == 0 {
+		return true
+	}
+	for _, allowed := range cmd.states {
+		if allowed == state {
+			return true
+		}
+	}
+	return false
+}
+
+// registry holds the commands of the Server by their names and aliases.
+type registry struct {
+	commands []*command
+	byName   map[string]*command
+	// names are the names and aliases from the longest to the shortest, used to parse glued arguments
+	names []string
+}
+
+// newRegistry creates a registry of the commands. It panics on a duplicate name or alias, since
+// that is a programming error.
+func newRegistry(commands ...*command) *registry {
+	reg := &registry{
+		commands: commands,
+		byName:   make(map[string]*command),
+	}
+	for _, cmd := range commands {
+		for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+			if _, ok := reg.byName[name]; ok {
+				panic(fmt.Sprintf("duplicate command name: %s", name))
+			}
+			reg.byName[name] = cmd
+			reg.names = append(reg.names, name)
+		}
+	}
+	sort.SliceStable(reg.names, func(i, j int) bool {
+		return len(reg.names[i]) > len(reg.names[j])
+	})
+	return reg
+}
+
+// visible returns the commands which are not hidden.
+func (reg *registry) visible() []*command {
+	commands := []*command{}
+	for _, cmd := range reg.commands {
+		if !cmd.hidden {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// lookup returns the command by its name or alias (case-insensitive).
+func (reg *registry) lookup(name string) (*command, bool) {
+	cmd, ok := reg.byName[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// lookupGlued finds a command whose duration argument is glued to its name (e.g. "back1m24s"),
+// and returns the command with the argument. The rest of the word has to be a valid duration,
+// so "backward" is never parsed as "back" + "ward".
+func (reg *registry) lookupGlued(word string) (*command, string, bool) {
+	lower := strings.ToLower(word)
+	for _, name := range reg.names {
+		cmd := reg.byName[name]
+		if len(cmd.args) == 0 || cmd.args[0].kind != argDuration || !strings.HasPrefix(lower, name) || lower == name {
+			continue
+		}
+		value := word[len(name):]
+		if _, err := tools.StringToSeconds(value); err == nil {
+			return cmd, value, true
+		}
+	}
+	return nil, "", false
+}
+
+// parse converts a text command into a Request. The arguments are separated by spaces, a duration argument
+// can also be glued to the name of the command (e.g. "back 1m24s" and "back1m24s" are the same).
+func (reg *registry) parse(text string) (model.Request, *model.ProtocolError) {
+	req := model.Request{Version: model.ProtocolVersion}
+
+	text = strings.TrimSpace(text)
+	word, rest, _ := strings.Cut(text, " ")
+	rest = strings.TrimSpace(rest)
+
+	cmd, ok := reg.lookup(word)
+	if !ok {
+		var glued string
+		if cmd, glued, ok = reg.lookupGlued(word); !ok {
+			return req, reg.unknown(word)
+		}
+		rest = strings.TrimSpace(glued + " " + rest)
+	}
+	req.Command = cmd.name
+
+	for _, arg := range cmd.args {
+		if rest == "" {
+			if !arg.optional {
+				return req, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Missing argument %s (usage: %s)", arg.usage(), cmd.usage())
+			}
+			break
+		}
+
+		var value string
+		if arg.kind == argName {
+			value, rest = rest, ""
+		} else {
+			value, rest, _ = strings.Cut(rest, " ")
+			rest = strings.TrimSpace(rest)
+		}
+
+		if err := arg.parse(value, &req); err != nil {
+			return req, cmd.invalid(arg, err)
+		}
+	}
+
+	if rest != "" {
+		return req, model.NewProtocolError(model.ErrorCodeInvalidArgument, "Too many arguments for %s: %s (usage: %s)", cmd.name, rest, cmd.usage())
+	}
+
+	return req, nil
+}
+
+// unknown returns the error of an unknown command, listing the commands of the registry.
+func (reg *registry) unknown(name string) *model.ProtocolError {
+	usages := []string{}
+	for _, cmd := range reg.visible() {
+		usages = append(usages, cmd.usage())
+	}
+	return model.NewProtocolError(model.ErrorCodeUnknownCommand,
+		"Unknown command: %s Allowed commands: %s (issue help <command> for details)", name, strings.Join(usages, ", "))
+}
+
+// infos returns the description of every command of the registry.
+func (reg *registry) infos() []model.CommandInfo {
+	infos := []model.CommandInfo{}
+	for _, cmd := range reg.visible() {
+		infos = append(infos, cmd.info())
+	}
+	return infos
+}
+
+// help returns the list of the commands, or the details of one command if its name is given.
+func (reg *registry) help(name string) (string, *model.ProtocolError) {
+	if name == "" {
+		width := 0
+		for _, cmd := range reg.visible() {
+			if len(cmd.usage()) > width {
+				width = len(cmd.usage())
+			}
+		}
+		lines := []string{"DotkaFX commands:"}
+		for _, cmd := range reg.visible() {
+			lines = append(lines, fmt.Sprintf("  %-*s  %s", width, cmd.usage(), cmd.help))
+		}
+		lines = append(lines, "Issue help <command> for the details of a command.")
+		return strings.Join(lines, "\n"), nil
+	}
+
+	cmd, ok := reg.lookup(name)
+	if !ok {
+		return "", reg.unknown(name)
+	}
+
+	lines := []string{fmt.Sprintf("%s - %s", cmd.usage(), cmd.help)}
+	if len(cmd.aliases) > 0 {
+		lines = append(lines, "Aliases: "+strings.Join(cmd.aliases, ", "))
+	}
+	if len(cmd.args) > 0 {
+		lines = append(lines, "Arguments:")
+		for _, arg := range cmd.args {
+			optional := ""
+			if arg.optional {
+				optional = ", optional"
+			}
+			lines = append(lines, fmt.Sprintf("  %s (%s%s): %s", arg.name, arg.kind, optional, arg.help))
+		}
+	}
+	if len(cmd.states) > 0 {
+		lines = append(lines, "Allowed when the Scheduler is: "+strings.Join(cmd.states, ", "))
+	}
+	return strings.Join(lines, "\n"), nil
+}
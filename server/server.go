@@ -2,122 +2,659 @@ package server
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"dotkafx/log"
-	"dotkafx/model"
-	"dotkafx/scheduler"
-	"dotkafx/sound"
-	"dotkafx/tools"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/sound"
+	"github.com/DonBattery/dotkafx/tools"
 )
 
 type Server struct {
-	fx  *sound.Player
-	sch *scheduler.Scheduler
-	cmd model.RootCommand
+	fx        *sound.Player
+	sch       *scheduler.Scheduler
+	cmd       model.RootCommand
+	overlay   fs.FS
+	cues      *cueQueue
+	startedAt time.Time
+	commands  *registry
+	// connections limits the number of concurrent connections on the control port, nil means unlimited
+	connections        chan struct{}
+	connectionHandlers sync.WaitGroup
+	// openConnections are the connections being handled, they are closed if they outlast the shutdown
+	openConnections map[net.Conn]struct{}
+	// listeners are the transports of the control port: the TCP Port and the Unix domain socket
+	listeners    []net.Listener
+	tcpListener  net.Listener
+	httpListener net.Listener
+	// ctx is done when the Server shuts down, cancel stops Serve, both are nil while the Server is not serving
+	ctx    context.Context
+	cancel context.CancelFunc
+	// testingSounds tells whether the sounds of a test-all command are being played
+	testingSounds bool
+	mu            sync.Mutex
 }
 
-func NewServer(fx *sound.Player, sch *scheduler.Scheduler, cmd model.RootCommand) *Server {
-	return &Server{
-		fx:  fx,
-		sch: sch,
-		cmd: cmd,
+const (
+	// shutdownTimeout is the maximum time the Server waits for the pending requests and the goodbye sound on shutdown
+	shutdownTimeout = 5 * time.Second
+	// rejectPeekTimeout is the time a rejected connection has to send the first byte of its request
+	rejectPeekTimeout = 100 * time.Millisecond
+)
+
+// NewServer creates a new Server. The overlay is the embedded browser overlay served by the HTTP API.
+func NewServer(fx *sound.Player, sch *scheduler.Scheduler, cmd model.RootCommand, overlay fs.FS) *Server {
+	srv := &Server{
+		fx:      fx,
+		sch:     sch,
+		cmd:     cmd,
+		overlay: overlay,
+		cues:    newCueQueue(fx, sch.Bus, cueQueueCapacity),
+		// the uptime is counted from the creation of the Server
+		startedAt: time.Now(),
+		commands:  newCommands(),
+		// the connections are closed after the shutdown timeout
+		openConnections: make(map[net.Conn]struct{}),
+	}
+	if cmd.MaxConnections > 0 {
+		srv.connections = make(chan struct{}, cmd.MaxConnections)
+	}
+	return srv
+}
+
+// acquireConnection takes a slot for a new connection, it returns false if the Server is handling
+// the maximum number of connections already.
+func (srv *Server) acquireConnection() bool {
+	if srv.connections == nil {
+		return true
+	}
+	select {
+	case srv.connections <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseConnection frees the slot of a closed connection.
+func (srv *Server) releaseConnection() {
+	if srv.connections != nil {
+		<-srv.connections
 	}
 }
 
-func (srv *Server) handleConnection(conn net.Conn) {
-	log.Debug("Received TCP connection. Local address: %s Remote address: %s", conn.LocalAddr(), conn.RemoteAddr())
+// readRequest reads the request line of the connection within the read timeout.
+func (srv *Server) readRequest(conn net.Conn, reader *bufio.Reader) (string, error) {
+	if srv.cmd.ReadTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(srv.cmd.ReadTimeout)); err != nil {
+			return "", err
+		}
+	}
+
+	request, err := reader.ReadString('\n')
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", fmt.Errorf("No request received within %s", srv.cmd.ReadTimeout)
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(request), nil
+}
+
+// writeResponse writes the response line of the connection.
+func (srv *Server) writeResponse(conn net.Conn, response string) {
+	log.Debug("Sending response: %s Local address: %s Remote address: %s", response, conn.LocalAddr(), peer(conn))
+	if srv.cmd.ReadTimeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(srv.cmd.ReadTimeout)); err != nil {
+			log.Error("Failed to set write deadline: %s Remote address: %s", err, peer(conn))
+		}
+	}
+	if _, err := conn.Write([]byte(response + "\n")); err != nil {
+		log.Error("Failed to write response: %s Local address: %s Remote address: %s", err, conn.LocalAddr(), peer(conn))
+	}
+}
+
+// closeConnection closes the connection and logs the failure.
+func closeConnection(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		log.Error("Failed to close connection properly: %s Local address: %s Remote address: %s", err, conn.LocalAddr(), peer(conn))
+	}
+}
+
+// rejectConnection responds to a connection over the limit with a busy error and closes it. The request is not read,
+// only its first byte is peeked within the rejectPeekTimeout to tell a JSON request from a text one, so a client
+// which does not send anything cannot hold up the rejection.
+func (srv *Server) rejectConnection(conn net.Conn) {
+	defer closeConnection(conn)
+
+	log.Warn("Rejected connection from %s: the maximum of %d connections is reached", peer(conn), srv.cmd.MaxConnections)
+
+	isJSON := false
+	if err := conn.SetReadDeadline(time.Now().Add(rejectPeekTimeout)); err == nil {
+		first, err := bufio.NewReader(conn).Peek(1)
+		isJSON = err == nil && first[0] == '{'
+	}
+	protoErr := model.NewProtocolError(model.ErrorCodeBusy, "The Server is busy, the maximum of %d connections is reached", srv.cmd.MaxConnections)
+	srv.writeResponse(conn, srv.errorResponse(isJSON, protoErr))
+}
+
+func (srv *Server) handleConnection(ctx context.Context, conn net.Conn) {
+	log.Debug("Received connection. Local address: %s Remote address: %s", conn.LocalAddr(), peer(conn))
+
+	var (
+		response string
+		res      result
+	)
+
+	// the shutdown starts after the connection is closed, so the client gets the response right away
 	defer func() {
-		if err := conn.Close(); err != nil {
-			log.Error("Failed to close TCP connection properly: %s Local address: %s Remote address: %s", err, conn.LocalAddr(), conn.RemoteAddr())
+		if res.shutdown {
+			srv.stop()
 		}
 	}()
 
-	request, err := bufio.NewReader(conn).ReadString('\n')
+	defer srv.releaseConnection()
+	defer closeConnection(conn)
+
+	reader := bufio.NewReader(conn)
+	request, err := srv.readRequest(conn, reader)
 	if err != nil {
-		log.Error("Failed to read client request: %s", err)
+		log.Warn("Rejected connection from %s: %s", peer(conn), err)
 		return
 	}
-	request = strings.TrimSpace(request)
-	log.Info("Request received: %s", request)
 
-	response := ""
+	response, res = srv.handleRequest(request, peer(conn), false)
+	srv.writeResponse(conn, response)
 
 	switch {
+	case res.watch:
+		srv.watch(ctx, conn, strings.HasPrefix(request, "{"), res.ticks)
+	case res.session:
+		res = srv.session(ctx, conn, reader)
+	}
+}
+
+// session executes the requests of a connection one after the other, until the client disconnects, the context
+// is done or a shutdown command is received. The stream commands (watch and session) are refused. The client may
+// be idle between the requests, so the read timeout is not applied. It returns the result of the last request.
+func (srv *Server) session(ctx context.Context, conn net.Conn, reader *bufio.Reader) result {
+	log.Debug("Session started: %s", peer(conn))
+	defer log.Debug("Session ended: %s", peer(conn))
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return result{}
+	}
+
+	// the expired deadline unblocks the pending read on shutdown
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetReadDeadline(time.Now())
+		case <-stopped:
+		}
+	}()
+
+	for {
+		request, err := reader.ReadString('\n')
+		if err != nil {
+			return result{}
+		}
+		request = strings.TrimSpace(request)
+		if request == "" {
+			continue
+		}
+
+		response, res := srv.handleRequest(request, peer(conn), true)
+		srv.writeResponse(conn, response)
+
+		if res.shutdown {
+			return res
+		}
+	}
+}
 
-	case request == "test":
-		log.Debug("Testing Sound Output")
-		srv.fx.Play(sound.ChaosDunk)
-		response = "Test succeeded"
+// handleRequest executes a JSON or a legacy text request, inSession tells whether it was received within a session.
+// A panic while handling the request is logged and reported to the client as an internal error, instead of crashing
+// the Server.
+func (srv *Server) handleRequest(request string, from string, inSession bool) (response string, res result) {
+	isJSON := strings.HasPrefix(request, "{")
 
-	case request == "start":
-		response = srv.sch.Start()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Panic while handling request from %s: %v\n%s", from, r, debug.Stack())
+			response = srv.errorResponse(isJSON, model.NewProtocolError(model.ErrorCodeInternal, "Internal error while handling the request"))
+			res = result{}
+		}
+	}()
 
-	case request == "stop":
-		response = srv.sch.Stop()
+	if isJSON {
+		return srv.handleJSONRequest(request, from, inSession)
+	}
+	return srv.handleTextRequest(request, from, inSession)
+}
 
-	case request == "pause":
-		response = srv.sch.Pause()
+// errorResponse returns the response of a failed request in the protocol of the request.
+func (srv *Server) errorResponse(isJSON bool, protoErr *model.ProtocolError) string {
+	if !isJSON {
+		return textLine(protoErr.Message)
+	}
+	data, err := json.Marshal(srv.response(model.Request{}, result{}, protoErr))
+	if err != nil {
+		log.Error("Failed to encode JSON response: %s", err)
+		return `{"version":1,"ok":false,"error":{"code":"internal","message":"Failed to encode JSON response"}}`
+	}
+	return string(data)
+}
 
-	case request == "shutdown":
-		srv.fx.Play(sound.DotkaFXServerIsShuttingDown)
-		time.Sleep(time.Second * 3)
-		log.Shutdown("gg wp")
+// columnGap is the padding between the columns of a message (e.g. the list of the commands)
+var columnGap = regexp.MustCompile(`\s{2,}`)
+
+// textLine joins the lines of a message (e.g. the status or the timeline) into a single line, since the text
+// clients read one line per response: "Next events:\n  00:03:00 Bounty Runes" becomes
+// "Next events: 00:03:00 Bounty Runes", the other lines are separated by "; " and the columns by " - ".
+func textLine(message string) string {
+	var line strings.Builder
+	for _, part := range strings.Split(message, "\n") {
+		part = columnGap.ReplaceAllString(strings.TrimSpace(part), " - ")
+		if part == "" {
+			continue
+		}
+		if line.Len() > 0 {
+			if strings.HasSuffix(line.String(), ":") {
+				line.WriteString(" ")
+			} else {
+				line.WriteString("; ")
+			}
+		}
+		line.WriteString(part)
+	}
+	return line.String()
+}
+
+// handleTextRequest executes a legacy text command and returns the human readable response with the result,
+// in a single line.
+func (srv *Server) handleTextRequest(text string, from string, inSession bool) (string, result) {
+	token, text := splitTextToken(text)
+	log.Info("Request received: %s", text)
+
+	if protoErr := srv.authorize(token, from); protoErr != nil {
+		return textLine(protoErr.Message), result{}
+	}
+
+	req, protoErr := srv.commands.parse(text)
+	if protoErr != nil {
+		return textLine(protoErr.Message), result{}
+	}
+
+	res, protoErr := srv.execute(req, inSession)
+	if protoErr != nil {
+		return textLine(protoErr.Message), result{}
+	}
+
+	return textLine(res.message), res
+}
+
+// handleJSONRequest executes a JSON Request and returns the encoded Response with the result.
+func (srv *Server) handleJSONRequest(text string, from string, inSession bool) (string, result) {
+	var (
+		req      model.Request
+		res      result
+		protoErr *model.ProtocolError
+	)
+
+	if err := json.Unmarshal([]byte(text), &req); err != nil {
+		protoErr = model.NewProtocolError(model.ErrorCodeBadRequest, "Failed to parse JSON request: %s", err)
+	} else if req.Version != model.ProtocolVersion {
+		protoErr = model.NewProtocolError(model.ErrorCodeUnsupportedVersion, "Unsupported protocol version: %d Supported version: %d", req.Version, model.ProtocolVersion)
+	} else {
+		if req.Command == "" && req.Line != "" {
+			req, protoErr = srv.parseLine(req)
+		}
+		log.Info("JSON request received: %s (id: %s)", req.Command, req.ID)
+		if protoErr == nil {
+			protoErr = srv.authorize(req.Token, from)
+		}
+		if protoErr == nil {
+			res, protoErr = srv.execute(req, inSession)
+		}
+	}
+
+	data, err := json.Marshal(srv.response(req, res, protoErr))
+	if err != nil {
+		log.Error("Failed to encode JSON response: %s", err)
+		return `{"version":1,"ok":false,"error":{"code":"internal","message":"Failed to encode JSON response"}}`, result{}
+	}
 
-	case strings.HasPrefix(request, "back"):
-		amount, err := tools.ParseSuffixAmount(request, "back")
+	return string(data), res
+}
+
+// parseLine parses the command line of a JSON Request into its Command and arguments, keeping the fields
+// which are not part of the text protocol.
+func (srv *Server) parseLine(req model.Request) (model.Request, *model.ProtocolError) {
+	parsed, protoErr := srv.commands.parse(req.Line)
+	parsed.ID = req.ID
+	parsed.Token = req.Token
+	parsed.Line = req.Line
+	if parsed.Events == 0 {
+		parsed.Events = req.Events
+	}
+	return parsed, protoErr
+}
+
+// response creates the JSON Response of a Request with the current state of the Scheduler.
+func (srv *Server) response(req model.Request, res result, protoErr *model.ProtocolError) model.Response {
+	state, gameTime := srv.sch.Status()
+
+	events := req.Events
+	if events <= 0 {
+		events = defaultNextEvents
+	}
+
+	return model.Response{
+		Version:    model.ProtocolVersion,
+		ID:         req.ID,
+		OK:         protoErr == nil,
+		Error:      protoErr,
+		Message:    res.message,
+		State:      state,
+		GameTime:   gameTime,
+		GameClock:  tools.SecondsToString(gameTime),
+		NextEvents: srv.upcomingEvents(events, gameTime),
+		Sounds:     res.sounds,
+		Cues:       res.cues,
+		Status:     res.status,
+		Timeline:   res.timeline,
+		Commands:   res.commands,
+	}
+}
+
+// upcomingEvents returns the next n events of the timeline with the seconds remaining until them.
+func (srv *Server) upcomingEvents(n int, gameTime int) []model.UpcomingEvent {
+	nextEvents := []model.UpcomingEvent{}
+	for _, event := range srv.sch.NextEvents(n) {
+		nextEvents = append(nextEvents, model.UpcomingEvent{
+			Name:        event.Name,
+			SoundEffect: event.SoundEffect,
+			GameTime:    event.GameTime,
+			GameClock:   tools.SecondsToString(event.GameTime),
+			In:          event.GameTime - gameTime,
+		})
+	}
+	return nextEvents
+}
+
+// stop makes Serve shut the Server down. It does nothing if the Server is not serving.
+func (srv *Server) stop() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.cancel != nil {
+		srv.cancel()
+	}
+}
+
+// Listen opens the control port, and the port of the HTTP API if it is enabled.
+func (srv *Server) Listen() error {
+	if srv.cmd.NoTCP && srv.cmd.Socket == "" {
+		return fmt.Errorf("The Server needs the TCP Port or a --socket to listen on")
+	}
+
+	if !srv.cmd.NoTCP {
+		lis, err := net.Listen("tcp", srv.address(srv.cmd.Port))
 		if err != nil {
-			response = fmt.Sprintf("Incorrect input value for backward seconds: %s", err)
-		} else {
-			response = srv.sch.Back(amount)
+			return err
 		}
+		srv.tcpListener = lis
+		srv.listeners = append(srv.listeners, lis)
+		log.Info("DotkaFX server listening on %s", lis.Addr())
+	}
 
-	case strings.HasPrefix(request, "forward"):
-		amount, err := tools.ParseSuffixAmount(request, "forward")
+	if srv.cmd.Socket != "" {
+		lis, err := listenSocket(srv.cmd.Socket)
 		if err != nil {
-			response = fmt.Sprintf("Incorrect input value for forward seconds: %s", err)
-		} else {
-			response = srv.sch.Forward(amount)
+			srv.closeListeners()
+			return err
 		}
+		srv.listeners = append(srv.listeners, lis)
+		log.Info("DotkaFX server listening on the socket %s", srv.cmd.Socket)
+	}
 
-	default:
-		response = fmt.Sprintf("Unknown command: %s Allowed commands: start, stop, pause, back[seconds], forward[seconds], shutdown", request)
+	if srv.cmd.Token == "" {
+		log.Debug("No token is set, every request is accepted")
 	}
 
-	log.Debug("Sending response: %s Local address: %s Remote address: %s", response, conn.LocalAddr(), conn.RemoteAddr())
-	_, err = conn.Write([]byte(response + "\n"))
-	if err != nil {
-		log.Error("Failed to write response: %s Local address: %s Remote address: %s", err, conn.LocalAddr(), conn.RemoteAddr())
+	if srv.cmd.HTTPPort > 0 {
+		httpLis, err := net.Listen("tcp", srv.address(srv.cmd.HTTPPort))
+		if err != nil {
+			srv.closeListeners()
+			return err
+		}
+		srv.httpListener = httpLis
+		log.Info("DotkaFX HTTP API listening on %s", httpLis.Addr())
 	}
+
+	return nil
 }
 
-func (srv *Server) soundPlayer() error {
-	for {
-		sound := <-srv.sch.EventChan
-		srv.fx.Play(sound)
+// closeListeners closes the listeners of the control port. The socket file is removed by its listener.
+func (srv *Server) closeListeners() {
+	for _, lis := range srv.listeners {
+		_ = lis.Close()
 	}
 }
 
-func (srv *Server) Run() error {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", srv.cmd.Port))
+// Addr returns the address of the TCP control port once Listen succeeded, or nil if the Server does not listen on TCP.
+func (srv *Server) Addr() net.Addr {
+	if srv.tcpListener == nil {
+		return nil
+	}
+	return srv.tcpListener.Addr()
+}
+
+// Serve runs the Server on the opened ports until the context is done or a shutdown command is received.
+// On the way out it stops accepting connections, finishes the pending requests, plays the goodbye sound
+// (waiting for it to finish) and stops every goroutine of the Server.
+func (srv *Server) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	srv.mu.Lock()
+	srv.ctx = ctx
+	srv.cancel = cancel
+	srv.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		srv.sch.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		srv.cues.run(ctx)
+	}()
+
+	var httpSrv *http.Server
+	if srv.httpListener != nil {
+		httpSrv = &http.Server{
+			Handler:           srv.HTTPHandler(),
+			ReadHeaderTimeout: srv.cmd.ReadTimeout,
+			// the streams of the HTTP API end together with the Server
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := httpSrv.Serve(srv.httpListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("HTTP API stopped: %s", err)
+			}
+		}()
+	}
+
+	srv.fx.Play(sound.DotkaFXSercerIsOnline)
+
+	go func() {
+		<-ctx.Done()
+		// unblocks the Accept of acceptConnections
+		srv.closeListeners()
+	}()
+
+	// every transport accepts connections until the shutdown, or until one of them fails
+	errs := make(chan error, len(srv.listeners))
+	for _, lis := range srv.listeners {
+		lis := lis
+		go func() {
+			errs <- srv.acceptConnections(ctx, lis)
+		}()
+	}
+	err := <-errs
+	if ctx.Err() != nil {
+		// the listener was closed by the shutdown
+		err = nil
+	}
+	cancel()
+	for i := 1; i < len(srv.listeners); i++ {
+		<-errs
+	}
+
+	log.Info("DotkaFX Server is shutting down")
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	if httpSrv != nil {
+		if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error("Failed to shut down the HTTP API: %s", err)
+		}
+	}
+	srv.waitForConnections(shutdownCtx)
+
+	if err := srv.fx.PlayAndWait(shutdownCtx, sound.DotkaFXServerIsShuttingDown); err != nil {
+		log.Debug("Goodbye sound not played: %s", err)
+	}
+
+	srv.cues.close()
+	wg.Wait()
+
+	log.Shutdown("gg wp")
+	return err
+}
+
+// Run opens the ports of the Server and serves them until the context is done or a shutdown command is received.
+// If the command has a lock file, it is held while the Server runs: it records where the Server listens, and
+// an *AlreadyRunningError is returned if another Server holds it.
+func (srv *Server) Run(ctx context.Context) error {
+	if srv.cmd.LockFile == "" {
+		if err := srv.Listen(); err != nil {
+			return err
+		}
+		return srv.Serve(ctx)
+	}
+
+	lock, err := acquireLock(srv.cmd.LockFile)
 	if err != nil {
 		return err
 	}
+	defer lock.release()
 
-	log.Info("DotkaFX server listening on TCP Port %d", srv.cmd.Port)
+	if err := srv.Listen(); err != nil {
+		return err
+	}
 
-	go srv.soundPlayer()
+	port := 0
+	if addr, ok := srv.Addr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	if err := lock.update(port, srv.cmd.Socket); err != nil {
+		srv.closeListeners()
+		return fmt.Errorf("Failed to write the lock file %s: %s", srv.cmd.LockFile, err)
+	}
+	log.Debug("Lock file written: %s", srv.cmd.LockFile)
 
-	srv.fx.Play(sound.DotkaFXSercerIsOnline)
+	return srv.Serve(ctx)
+}
 
+// acceptConnections handles the connections of the control port until the listener is closed.
+// The watch streams of the connections end when the context is done.
+func (srv *Server) acceptConnections(ctx context.Context, lis net.Listener) error {
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
 			return err
 		}
-		go srv.handleConnection(conn)
+		srv.trackConnection(conn)
+		if !srv.acquireConnection() {
+			go func() {
+				defer srv.untrackConnection(conn)
+				srv.rejectConnection(conn)
+			}()
+			continue
+		}
+		go func() {
+			defer srv.untrackConnection(conn)
+			srv.handleConnection(ctx, conn)
+		}()
 	}
 }
+
+// trackConnection registers a connection before its handler starts.
+func (srv *Server) trackConnection(conn net.Conn) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.connectionHandlers.Add(1)
+	srv.openConnections[conn] = struct{}{}
+}
+
+// untrackConnection unregisters a connection after its handler returned.
+func (srv *Server) untrackConnection(conn net.Conn) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.openConnections, conn)
+	srv.connectionHandlers.Done()
+}
+
+// waitForConnections waits for the handlers of the connections until the context is done, then closes the
+// connections still open (e.g. a client which never sends its request), so their handlers return.
+func (srv *Server) waitForConnections(ctx context.Context) {
+	handled := make(chan struct{})
+	go func() {
+		srv.connectionHandlers.Wait()
+		close(handled)
+	}()
+
+	select {
+	case <-handled:
+		return
+	case <-ctx.Done():
+	}
+
+	srv.mu.Lock()
+	log.Warn("Closing %d connections still open after %s", len(srv.openConnections), shutdownTimeout)
+	for conn := range srv.openConnections {
+		_ = conn.Close()
+	}
+	srv.mu.Unlock()
+	<-handled
+}
+
+// address returns the listen address of the Server with the given port.
+func (srv *Server) address(port int) string {
+	return net.JoinHostPort(srv.cmd.Listen, strconv.Itoa(port))
+}
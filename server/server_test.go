@@ -0,0 +1,942 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/scheduler"
+	"github.com/DonBattery/dotkafx/server"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+// startServer serves a new Server on a random loopback port, and returns the port and the result of Serve.
+func startServer(t *testing.T, ctx context.Context, cmd model.RootCommand) (int, <-chan error) {
+	return serveServer(t, ctx, newServer(cmd))
+}
+
+// newServer creates a Server of the test profile, which listens on a random loopback port.
+func newServer(cmd model.RootCommand) *server.Server {
+	profile := model.ConfigProfile{
+		Name:        "test",
+		Countdown:   60,
+		MatchLength: 3600,
+		Events: map[string]model.Event{
+			"Bounty Runes": {FirstHappensAt: 180, Interval: 180, SoundEffect: "bounty_runes_appeared"},
+		},
+	}
+	cmd.Listen = "127.0.0.1"
+	cmd.Port = 0
+
+	return server.NewServer(sound.NewPlayer(embed.FS{}, nil), scheduler.NewScheduler(profile, nil), cmd, embed.FS{})
+}
+
+// serveServer serves the Server, and returns its port and the result of Serve.
+// The port is 0 if the Server does not listen on TCP.
+func serveServer(t *testing.T, ctx context.Context, srv *server.Server) (int, <-chan error) {
+	if err := srv.Listen(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx)
+	}()
+
+	if srv.Addr() == nil {
+		return 0, done
+	}
+	return srv.Addr().(*net.TCPAddr).Port, done
+}
+
+func TestServerLifecycle(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		cmd  model.RootCommand
+		stop func(cli *client.Client, cancel context.CancelFunc)
+	}{
+		"shutdownCommand": {
+			model.RootCommand{},
+			func(cli *client.Client, cancel context.CancelFunc) {
+				res, err := cli.Shutdown()
+				require.NoError(err)
+				require.Equal("DotkaFX Server is shutting down", res.Message)
+			},
+		},
+		"shutdownTextCommand": {
+			model.RootCommand{Token: "secret", MaxConnections: 2, ReadTimeout: time.Second},
+			func(cli *client.Client, cancel context.CancelFunc) {
+				response, err := cli.SendRequest("shutdown")
+				require.NoError(err)
+				require.Equal("DotkaFX Server is shutting down", response)
+			},
+		},
+		"cancelledContext": {
+			model.RootCommand{ReadTimeout: time.Second},
+			func(cli *client.Client, cancel context.CancelFunc) {
+				cancel()
+			},
+		},
+	}
+
+	// every case runs more than once, so the Servers have to clean up after themselves
+	for i := 0; i < 3; i++ {
+		for testCaseName, testCase := range testCases {
+			t.Logf("Testing server lifecycle, with %s (round %d)", testCaseName, i+1)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			port, done := startServer(t, ctx, testCase.cmd)
+			cli := client.NewClient(port).WithToken(testCase.cmd.Token)
+
+			res, err := cli.Start()
+			require.NoError(err, testCaseName)
+			require.Equal("running", res.State, testCaseName)
+
+			testCase.stop(cli, cancel)
+
+			select {
+			case err := <-done:
+				require.NoError(err, testCaseName)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("The Server did not stop, with %s", testCaseName)
+			}
+			cancel()
+
+			_, err = cli.Start()
+			require.Error(err, "the control port is still open, with %s", testCaseName)
+		}
+	}
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{Token: "secret", ReadTimeout: time.Second})
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	testCases := []struct {
+		name             string
+		token            string
+		request          string
+		requiredResponse string
+	}{
+		{"textWithoutToken", "", "start", "The token is missing, run the client with --token or set DOTKAFX_TOKEN"},
+		{"textWithInvalidToken", "", "token=wrong start", "Invalid token"},
+		{"textWithEmptyToken", "", "token= start", "The token is missing, run the client with --token or set DOTKAFX_TOKEN"},
+		{"textWithToken", "", "token=secret status", "Scheduler is stopped GameTime: -00:01:00"},
+		{"jsonWithoutToken", "", `{"version":1,"command":"start"}`, `"code":"unauthorized","message":"The token is missing`},
+		{"jsonWithInvalidToken", "wrong", "", `"code":"unauthorized","message":"Invalid token"`},
+		{"jsonWithToken", "secret", "", `"ok":true`},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing token authentication, with %s", testCase.name)
+		cli := client.NewClient(port).WithToken(testCase.token)
+		request := testCase.request
+		if request == "" {
+			data, err := json.Marshal(model.Request{Version: model.ProtocolVersion, Token: testCase.token, Command: "status"})
+			require.NoError(err, testCase.name)
+			request = string(data)
+		}
+		response, err := cli.SendRequest(request)
+		require.NoError(err, testCase.name)
+		require.Contains(response, testCase.requiredResponse, testCase.name)
+	}
+
+	// the rejected requests are not executed
+	res, err := client.NewClient(port).WithToken("secret").Status(0)
+	require.NoError(err)
+	require.Equal("stopped", res.State)
+}
+
+func TestMaxConnections(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{MaxConnections: 1})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	cli := client.NewClient(port)
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+
+	// the idle connection takes the only slot, the Server runs without a read timeout
+	idle, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	t.Logf("Testing max connections, with %s", "text")
+	// the connections are accepted in order, so the idle one has the slot already
+	response, err := cli.SendRequest("status")
+	require.NoError(err)
+	require.Equal("The Server is busy, the maximum of 1 connections is reached", response)
+
+	t.Logf("Testing max connections, with %s", "json")
+	_, err = cli.Status(0)
+	var protoErr *model.ProtocolError
+	if require.ErrorAs(err, &protoErr) {
+		require.Equal(model.ErrorCodeBusy, protoErr.Code)
+	}
+
+	t.Logf("Testing max connections, with %s", "silentClient")
+	// the busy response is written without waiting for the request
+	silent, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	require.NoError(silent.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	line, err := bufio.NewReader(silent).ReadString('\n')
+	require.NoError(err)
+	require.Equal("The Server is busy, the maximum of 1 connections is reached\n", line)
+
+	t.Logf("Testing max connections, with %s", "releasedSlot")
+	require.NoError(idle.Close())
+	require.Eventually(func() bool {
+		res, err := cli.Status(0)
+		return err == nil && res.OK
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReadTimeout(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{ReadTimeout: 200 * time.Millisecond})
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	testCases := []struct {
+		name    string
+		partial string
+	}{
+		{"nothingSent", ""},
+		{"partialRequest", "sta"},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing read timeout, with %s", testCase.name)
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testCase.partial != "" {
+			_, err = conn.Write([]byte(testCase.partial))
+			require.NoError(err, testCase.name)
+		}
+
+		start := time.Now()
+		require.NoError(conn.SetReadDeadline(time.Now().Add(5*time.Second)), testCase.name)
+		// the Server closes the connection without a response
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		require.ErrorIs(err, io.EOF, testCase.name)
+		require.GreaterOrEqual(time.Since(start), 150*time.Millisecond, testCase.name)
+		conn.Close()
+	}
+
+	// the Server is still serving
+	res, err := client.NewClient(port).Status(0)
+	require.NoError(err)
+	require.True(res.OK)
+}
+
+func TestShutdownWithOpenConnection(t *testing.T) {
+	require := assert.New(t)
+
+	// without a read timeout the Server would wait for the request forever
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{})
+	defer cancel()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// the connection is being handled
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("The Server did not shut down with an open connection")
+	}
+	require.GreaterOrEqual(time.Since(start), 4*time.Second)
+
+	// the Server closed the connection without a response
+	require.NoError(conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = bufio.NewReader(conn).ReadString('\n')
+	require.ErrorIs(err, io.EOF)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := newServer(model.RootCommand{MaxConnections: 1})
+	srv.AddPanicCommand()
+	port, done := serveServer(t, ctx, srv)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	cli := client.NewClient(port)
+
+	t.Logf("Testing panic recovery, with %s", "text")
+	response, err := cli.SendRequest("panic")
+	require.NoError(err)
+	require.Equal("Internal error while handling the request", response)
+
+	t.Logf("Testing panic recovery, with %s", "json")
+	_, err = cli.Do(model.Request{Command: "panic"})
+	var protoErr *model.ProtocolError
+	if require.ErrorAs(err, &protoErr) {
+		require.Equal(model.ErrorCodeInternal, protoErr.Code)
+	}
+
+	// the connection slots of the panicked requests are released
+	res, err := cli.Start()
+	require.NoError(err)
+	require.Equal("running", res.State)
+}
+
+func TestStatusAndTimeline(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	cli := client.NewClient(port)
+
+	testCases := []struct {
+		name             string
+		request          string
+		requiredResponse string
+	}{
+		{"status", "status", "Scheduler is stopped GameTime: -00:01:00; Profile: test Config: embedded default config; Uptime: 0s; " +
+			"Next events: 00:03:00 Bounty Runes in 4m0s; 00:06:00 Bounty Runes in 7m0s; 00:09:00 Bounty Runes in 10m0s"},
+		{"statusWithEvents", "status 1", "Scheduler is stopped GameTime: -00:01:00; Profile: test Config: embedded default config; Uptime: 0s; " +
+			"Next events: 00:03:00 Bounty Runes in 4m0s"},
+		{"statusWithInvalidEvents", "status many", "Invalid value for [events]: many is not a positive number (usage: status [events])"},
+		{"statusWithTooManyEvents", "status 1000", "Invalid value for [events]: 1000 is more than 100 (usage: status [events])"},
+		{"timelineWindow", "timeline 5:00 10:00", "Timeline from 00:05:00 to 00:10:00: 2 events; 00:06:00 Bounty Runes (bounty_runes_appeared); " +
+			"00:09:00 Bounty Runes (bounty_runes_appeared)"},
+		{"timelineFrom", "timeline 55:00", "Timeline from 00:55:00 to 00:59:00: 1 event; 00:57:00 Bounty Runes (bounty_runes_appeared)"},
+		{"timelineReversed", "timeline 10:00 5:00", "The start of the timeline window (00:10:00) is after its end (00:05:00)"},
+		{"timelineInvalid", "timeline soon", "Invalid value for [from]: soon is not a game clock (usage: timeline [from] [to])"},
+		{"timelineTooManyArguments", "timeline 1:00 2:00 3:00", "Too many arguments for timeline: 3:00 (usage: timeline [from] [to])"},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing status and timeline, with %s", testCase.name)
+		response, err := cli.SendRequest(testCase.request)
+		require.NoError(err, testCase.name)
+		// the uptime depends on how long the test runs, so any number of seconds is accepted
+		pattern := strings.Replace(regexp.QuoteMeta(testCase.requiredResponse), "Uptime: 0s", `Uptime: \d+s`, 1)
+		require.Regexp("^"+pattern+"$", response, testCase.name)
+	}
+
+	t.Logf("Testing status and timeline, with %s", "jsonStatus")
+	res, err := cli.Do(model.Request{Command: "status", Events: 2})
+	require.NoError(err)
+	if require.NotNil(res.Status) {
+		require.Equal("test", res.Status.Profile)
+		require.False(res.Status.StartedAt.IsZero())
+	}
+	require.Len(res.NextEvents, 2)
+
+	t.Logf("Testing status and timeline, with %s", "jsonTimeline")
+	res, err = cli.Do(model.Request{Command: "timeline", From: "0:00", To: "3:00"})
+	require.NoError(err)
+	require.Equal([]model.TimelineEntry{
+		{Name: "Bounty Runes", SoundEffect: "bounty_runes_appeared", GameTime: 180, GameClock: "00:03:00"},
+	}, res.Timeline)
+}
+
+func TestSoundCommands(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	cli := client.NewClient(port)
+
+	testCases := []struct {
+		name            string
+		request         model.Request
+		requiredMessage string
+		requiredCode    string
+	}{
+		{"tone", model.Request{Command: "play", Name: "tone:440hz:50ms"}, "Playing tone:440hz:50ms (0.1s)", ""},
+		{"filePath", model.Request{Command: "play", Name: "/etc/dotkafx.mp3"}, "", model.ErrorCodeSoundError},
+		{"outOfThePack", model.Request{Command: "play", Name: "../../dotkafx"}, "", model.ErrorCodeSoundError},
+		// the sounds are not loaded by the test Server, and test-all does not wait for them anyway
+		{"testAll", model.Request{Command: "test-all"}, "Playing 0 sounds, 1 sounds are not loaded: bounty_runes_appeared", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing sound commands, with %s", testCase.name)
+		res, err := cli.Do(testCase.request)
+		if testCase.requiredCode != "" {
+			var protoErr *model.ProtocolError
+			require.ErrorAs(err, &protoErr, testCase.name)
+			require.Equal(testCase.requiredCode, protoErr.Code, testCase.name)
+			require.Contains(protoErr.Message, "cannot be a path", testCase.name)
+			continue
+		}
+		require.NoError(err, testCase.name)
+		require.Equal(testCase.requiredMessage, res.Message, testCase.name)
+	}
+}
+
+func TestCommandGrammar(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	cli := client.NewClient(port)
+
+	testCases := []struct {
+		name             string
+		request          string
+		requiredResponse string
+	}{
+		{"backWhenStopped", "back 10", "The back command cannot be used while the Scheduler is stopped, it has to be running"},
+		{"stopWhenStopped", "stop", "The stop command cannot be used while the Scheduler is stopped, it has to be running or paused"},
+		{"start", "start", "Scheduler started GameTime: -00:01:00"},
+		{"forwardWithSpace", "forward 10m", "Scheduler rolled forward by 600 seconds. GameTime: 00:09:00"},
+		{"backWithSpace", "back 1m24s", "Scheduler rolled backwards by 84 seconds. GameTime: 00:07:36"},
+		{"backGlued", "back1m24s", "Scheduler rolled backwards by 84 seconds. GameTime: 00:06:12"},
+		{"backWithoutAmount", "back", "Scheduler rolled backwards by 1 seconds. GameTime: 00:06:11"},
+		{"aliasGlued", "backward30", "Scheduler rolled backwards by 30 seconds. GameTime: 00:05:41"},
+		{"alias", "FWD 1", "Scheduler rolled forward by 1 seconds. GameTime: 00:05:42"},
+		{"backTooMuch", "back 1h", "Invalid value for [seconds]: 1h is more than 30m0s (usage: back [seconds])"},
+		{"backZero", "back 0", "Invalid value for [seconds]: 0 is less than 1 second (usage: back [seconds])"},
+		{"backInvalid", "back soon", "Invalid value for [seconds]: soon is not a duration (usage: back [seconds])"},
+		{"backTooManyArguments", "back 1 2", "Too many arguments for back: 2 (usage: back [seconds])"},
+		{"previewUnknownEvent", "preview Roshan Respawn", "Unknown event: Roshan Respawn"},
+		{"playWithoutName", "play", "Missing argument <sound name> (usage: play <sound name>)"},
+		{"helpCommand", "help back", "back [seconds] - roll the Scheduler back, e.g. back 1m24s or back1m24s; Aliases: backward, rewind; " +
+			"Arguments: seconds (duration, optional): seconds or a duration like 1m24s, 1 second by default, at most 30m0s; " +
+			"Allowed when the Scheduler is: running"},
+		{"helpAlias", "help fwd", "forward [seconds] - roll the Scheduler forward, e.g. forward 30 or forward30; Aliases: fwd; " +
+			"Arguments: seconds (duration, optional): seconds or a duration like 30s, 1 second by default, at most 30m0s; " +
+			"Allowed when the Scheduler is: running"},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing command grammar, with %s", testCase.name)
+		response, err := cli.SendRequest(testCase.request)
+		require.NoError(err, testCase.name)
+		require.Equal(testCase.requiredResponse, response, testCase.name)
+	}
+
+	unknownCommands := []string{"backx", "backward1x", "bounce", "help nope", "quit", "exit"}
+	for _, request := range unknownCommands {
+		t.Logf("Testing command grammar, with unknown command %s", request)
+		response, err := cli.SendRequest(request)
+		require.NoError(err, request)
+		require.Contains(response, "Unknown command: ", request)
+		require.Contains(response, "Allowed commands: start, stop, pause, back [seconds], forward [seconds], status [events], timeline [from] [to]", request)
+	}
+
+	t.Logf("Testing command grammar, with %s", "help")
+	response, err := cli.SendRequest("help")
+	require.NoError(err)
+	// the text clients get the list of the commands in a single line
+	require.NotContains(response, "\n")
+	require.True(strings.HasPrefix(response, "DotkaFX commands: start - start the Scheduler"))
+	require.Contains(response, "; play <sound name> - play a sound; ")
+	require.True(strings.HasSuffix(response, "; Issue help <command> for the details of a command."))
+	help, err := cli.Do(model.Request{Command: "help"})
+	require.NoError(err)
+	// the JSON clients get the message with its lines
+	require.Contains(help.Message, "\n  play <sound name>     play a sound\n")
+	// the session command is only used by the clients internally
+	require.NotContains(response, "session")
+	commands, err := cli.Commands()
+	require.NoError(err)
+	for _, command := range commands {
+		require.NotEqual("session", command.Name)
+	}
+
+	t.Logf("Testing command grammar, with %s", "jsonAlias")
+	res, err := cli.Do(model.Request{Command: "rewind", Seconds: 5})
+	require.NoError(err)
+	require.Equal("Scheduler rolled backwards by 5 seconds. GameTime: 00:05:37", res.Message)
+
+	// the arguments of the JSON Requests are checked like the ones of the text commands
+	jsonTestCases := []struct {
+		name            string
+		request         model.Request
+		requiredMessage string
+	}{
+		{"jsonBackTooMuch", model.Request{Command: "back", Seconds: 3600}, "Invalid value for [seconds]: 3600 is more than 30m0s (usage: back [seconds])"},
+		{"jsonForwardNegative", model.Request{Command: "forward", Seconds: -5}, "Invalid value for [seconds]: -5 is less than 1 second (usage: forward [seconds])"},
+		{"jsonStatusNegative", model.Request{Command: "status", Events: -1}, "Invalid value for [events]: -1 is not a positive number (usage: status [events])"},
+		{"jsonStatusTooMany", model.Request{Command: "status", Events: 101}, "Invalid value for [events]: 101 is more than 100 (usage: status [events])"},
+		{"jsonTimelineInvalidTo", model.Request{Command: "timeline", From: "1:00", To: "soon"}, "Invalid value for [to]: soon is not a game clock (usage: timeline [from] [to])"},
+	}
+	for _, testCase := range jsonTestCases {
+		t.Logf("Testing command grammar, with %s", testCase.name)
+		_, err := cli.Do(testCase.request)
+		var protoErr *model.ProtocolError
+		if require.ErrorAs(err, &protoErr, testCase.name) {
+			require.Equal(model.ErrorCodeInvalidArgument, protoErr.Code, testCase.name)
+			require.Equal(testCase.requiredMessage, protoErr.Message, testCase.name)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	require := assert.New(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix domain socket permissions are not supported on Windows")
+	}
+
+	testCases := map[string]struct {
+		noTCP   bool
+		prepare func(path string)
+	}{
+		"socketOnly":   {true, func(path string) {}},
+		"socketAndTCP": {false, func(path string) {}},
+		"staleSocket": {true, func(path string) {
+			lis, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// leave the socket file behind, as a crashed Server would
+			lis.(*net.UnixListener).SetUnlinkOnClose(false)
+			_ = lis.Close()
+		}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing unix socket, with %s", testCaseName)
+
+		// the path of a socket is limited to about 100 characters, so the socket is not put into t.TempDir()
+		dir, err := os.MkdirTemp("", "dotkafx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dotkafx.sock")
+		testCase.prepare(path)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		port, done := startServer(t, ctx, model.RootCommand{Socket: path, NoTCP: testCase.noTCP})
+
+		info, err := os.Stat(path)
+		if require.NoError(err, testCaseName) {
+			require.Equal(os.FileMode(0600), info.Mode().Perm(), testCaseName)
+		}
+
+		res, err := client.NewClient(0).WithSocket(path).Start()
+		require.NoError(err, testCaseName)
+		require.Equal("running", res.State, testCaseName)
+
+		if testCase.noTCP {
+			require.Equal(0, port, testCaseName)
+		} else {
+			res, err = client.NewClient(port).Pause()
+			require.NoError(err, testCaseName)
+			require.Equal("paused", res.State, testCaseName)
+		}
+
+		response, err := client.NewClient(0).WithSocket(path).SendRequest("shutdown")
+		require.NoError(err, testCaseName)
+		require.Equal("DotkaFX Server is shutting down", response, testCaseName)
+
+		select {
+		case err := <-done:
+			require.NoError(err, testCaseName)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("The Server did not stop, with %s", testCaseName)
+		}
+		cancel()
+
+		_, err = os.Stat(path)
+		require.True(os.IsNotExist(err), "the socket is not removed, with %s", testCaseName)
+	}
+}
+
+func TestUnixSocketInUse(t *testing.T) {
+	require := assert.New(t)
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix domain socket permissions are not supported on Windows")
+	}
+
+	dir, err := os.MkdirTemp("", "dotkafx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dotkafx.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, done := startServer(t, ctx, model.RootCommand{Socket: path, NoTCP: true})
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	profile := model.ConfigProfile{MatchLength: 600, Events: map[string]model.Event{}}
+	newServer := func(cmd model.RootCommand) *server.Server {
+		return server.NewServer(sound.NewPlayer(embed.FS{}, nil), scheduler.NewScheduler(profile, nil), cmd, embed.FS{})
+	}
+
+	t.Logf("Testing unix socket in use, with %s", "liveSocket")
+	err = newServer(model.RootCommand{Socket: path, NoTCP: true}).Listen()
+	require.EqualError(err, "Another Server is already listening on the socket "+path)
+
+	t.Logf("Testing unix socket in use, with %s", "regularFile")
+	file := filepath.Join(dir, "not_a_socket")
+	require.NoError(os.WriteFile(file, []byte("keep me"), 0600))
+	err = newServer(model.RootCommand{Socket: file, NoTCP: true}).Listen()
+	require.EqualError(err, "The socket path "+file+" exists and it is not a socket")
+	_, err = os.Stat(file)
+	require.NoError(err)
+
+	t.Logf("Testing unix socket in use, with %s", "noTransport")
+	err = newServer(model.RootCommand{NoTCP: true}).Listen()
+	require.EqualError(err, "The Server needs the TCP Port or a --socket to listen on")
+
+	res, err := client.NewClient(0).WithSocket(path).Start()
+	require.NoError(err)
+	require.Equal("running", res.State)
+}
+
+func TestWatch(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		ticks         bool
+		requiredKinds []string
+	}{
+		"events":         {false, []string{"state", "started", "forward", "paused"}},
+		"eventsAndTicks": {true, []string{"state", "started", "tick"}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing watch, with %s", testCaseName)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		port, done := startServer(t, ctx, model.RootCommand{ReadTimeout: time.Second})
+		cli := client.NewClient(port)
+
+		notifications := make(chan model.Notification, 100)
+		watched := make(chan error, 1)
+		go func() {
+			watched <- cli.Watch(context.Background(), testCase.ticks, func(notification model.Notification) {
+				notifications <- notification
+			})
+		}()
+
+		// the snapshot arrives once the stream is subscribed
+		var kinds []string
+		select {
+		case notification := <-notifications:
+			kinds = append(kinds, notification.Kind)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No snapshot received, with %s", testCaseName)
+		}
+
+		_, err := cli.Start()
+		require.NoError(err, testCaseName)
+		if !testCase.ticks {
+			_, err = cli.Forward(30)
+			require.NoError(err, testCaseName)
+			_, err = cli.Pause()
+			require.NoError(err, testCaseName)
+		}
+
+		for len(kinds) < len(testCase.requiredKinds) {
+			select {
+			case notification := <-notifications:
+				kinds = append(kinds, notification.Kind)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Missing notifications, with %s: %v", testCaseName, kinds)
+			}
+		}
+		require.Equal(testCase.requiredKinds, kinds, testCaseName)
+
+		// the shutdown of the Server ends the stream without an error
+		_, err = cli.Shutdown()
+		require.NoError(err, testCaseName)
+		select {
+		case err := <-watched:
+			require.NoError(err, testCaseName)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("The stream did not end, with %s", testCaseName)
+		}
+		select {
+		case err := <-done:
+			require.NoError(err, testCaseName)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("The Server did not stop, with %s", testCaseName)
+		}
+		cancel()
+	}
+}
+
+func TestWatchText(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	port, done := startServer(t, ctx, model.RootCommand{Token: "secret", MaxConnections: 2, ReadTimeout: time.Second})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	cli := client.NewClient(port).WithToken("secret")
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	readLine := func() string {
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		line, err := reader.ReadString('\n')
+		require.NoError(err)
+		return line
+	}
+
+	_, err = fmt.Fprintln(conn, "token=secret watch")
+	require.NoError(err)
+	require.Equal("Watching the Scheduler until the connection is closed\n", readLine())
+	require.Equal("[-00:01:00] state: Scheduler is stopped\n", readLine())
+
+	_, err = cli.Start()
+	require.NoError(err)
+	require.Equal("[-00:01:00] started: Scheduler is running\n", readLine())
+
+	_, err = cli.Forward(10)
+	require.NoError(err)
+	require.Contains(readLine(), "] forward: Scheduler rolled forward by 10 seconds")
+
+	response, err := cli.SendRequest("watch every second")
+	require.NoError(err)
+	require.Equal("Invalid value for [ticks]: every is not ticks (usage: watch [ticks])", response)
+
+	response, err = cli.SendRequest("watch ticks please")
+	require.NoError(err)
+	require.Equal("Too many arguments for watch: please (usage: watch [ticks])", response)
+
+	// the connection slot of the watch client is released once it disconnects
+	require.NoError(conn.Close())
+	require.Eventually(func() bool {
+		watcher, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return false
+		}
+		defer watcher.Close()
+		if _, err := fmt.Fprintln(watcher, "token=secret watch"); err != nil {
+			return false
+		}
+		line, err := bufio.NewReader(watcher).ReadString('\n')
+		return err == nil && line == "Watching the Scheduler until the connection is closed\n"
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err = cli.Status(1)
+	require.NoError(err)
+}
+
+func TestSession(t *testing.T) {
+	require := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	port, done := startServer(t, ctx, model.RootCommand{Token: "secret", ReadTimeout: 200 * time.Millisecond})
+
+	session, err := client.NewClient(port).WithToken("secret").Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	testCases := []struct {
+		name            string
+		line            string
+		requiredMessage string
+		requiredCode    string
+	}{
+		{"start", "start", "Scheduler started", ""},
+		{"gluedArgument", "fwd30", "Scheduler rolled forward by 30 seconds.", ""},
+		{"alias", "PAUSE", "Scheduler paused.", ""},
+		{"invalidArgument", "back soon", "Invalid value for [seconds]: soon is not a duration (usage: back [seconds])", model.ErrorCodeInvalidArgument},
+		{"unknownCommand", "rewind-all", "", model.ErrorCodeUnknownCommand},
+		{"watchInSession", "watch ticks", "The watch command cannot be used within a session", model.ErrorCodeInvalidArgument},
+		{"sessionInSession", "session", "The session command cannot be used within a session", model.ErrorCodeInvalidArgument},
+		{"statusAfterRefusedStream", "status", "Scheduler is paused", ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Logf("Testing session, with %s", testCase.name)
+
+		res, err := session.Send(testCase.line)
+		if testCase.requiredCode != "" {
+			var protoErr *model.ProtocolError
+			if require.ErrorAs(err, &protoErr, testCase.name) {
+				require.Equal(testCase.requiredCode, protoErr.Code, testCase.name)
+				if testCase.requiredMessage != "" {
+					require.Equal(testCase.requiredMessage, protoErr.Message, testCase.name)
+				}
+			}
+			continue
+		}
+		require.NoError(err, testCase.name)
+		// the game time depends on the ticks of the Scheduler
+		require.Contains(res.Message, testCase.requiredMessage, testCase.name)
+	}
+
+	t.Logf("Testing session, with %s", "idleLongerThanReadTimeout")
+	time.Sleep(400 * time.Millisecond)
+	res, err := session.Do(model.Request{Command: "help", Name: "watch"})
+	require.NoError(err)
+	require.Equal([]model.CommandInfo{{
+		Name:  "watch",
+		Usage: "watch [ticks]",
+		Help:  "keep the connection open and stream a line for every event of the Scheduler",
+		Args:  []model.ArgumentInfo{{Name: "ticks", Kind: "switch", Optional: true, Help: "stream the game clock every second too"}},
+	}}, res.Commands)
+
+	t.Logf("Testing session, with %s", "shutdown")
+	res, err = session.Send("shutdown")
+	require.NoError(err)
+	require.Equal("DotkaFX Server is shutting down", res.Message)
+	select {
+	case err := <-done:
+		require.NoError(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("The Server did not stop")
+	}
+	_, err = session.Send("status")
+	require.Error(err)
+}
+
+func TestLockFile(t *testing.T) {
+	require := assert.New(t)
+
+	profile := model.ConfigProfile{MatchLength: 600, Events: map[string]model.Event{}}
+
+	testCases := map[string]struct {
+		existing      *model.ServerLock
+		age           time.Duration
+		requiredError bool
+	}{
+		"noLockFile": {nil, 0, false},
+		// the parent process (the go tool) is alive, so it holds the lock
+		"alreadyRunning": {&model.ServerLock{PID: os.Getppid(), Port: 1234}, 0, true},
+		// no process has this pid, so the lock is stale
+		"staleLockFile": {&model.ServerLock{PID: 1 << 30, Port: 1234}, 0, false},
+		// a recent unreadable lock file may be written by a starting Server
+		"unwrittenLockFile": {&model.ServerLock{}, 0, true},
+		"corruptLockFile":   {&model.ServerLock{}, time.Minute, false},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing lock file, with %s", testCaseName)
+
+		dir, err := os.MkdirTemp("", "dotkafx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dotkafx.lock")
+
+		if testCase.existing != nil {
+			data, err := json.Marshal(testCase.existing)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testCase.existing.PID == 0 {
+				data = []byte("not json")
+			}
+			require.NoError(os.WriteFile(path, data, 0600), testCaseName)
+			modified := time.Now().Add(-testCase.age)
+			require.NoError(os.Chtimes(path, modified, modified), testCaseName)
+		}
+
+		cmd := model.RootCommand{Listen: "127.0.0.1", LockFile: path}
+		srv := server.NewServer(sound.NewPlayer(embed.FS{}, nil), scheduler.NewScheduler(profile, nil), cmd, embed.FS{})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run(ctx)
+		}()
+
+		if testCase.requiredError {
+			err := <-done
+			cancel()
+			var alreadyRunning *server.AlreadyRunningError
+			require.ErrorAs(err, &alreadyRunning, testCaseName)
+			require.Equal(testCase.existing.PID, alreadyRunning.Lock.PID, testCaseName)
+			required := fmt.Sprintf("DotkaFX Server is already running (pid %d, port 1234), remove %s if it is not",
+				os.Getppid(), path)
+			if testCase.existing.PID == 0 {
+				required = fmt.Sprintf("DotkaFX Server is starting (its lock file %s is not written yet), remove it if it is not", path)
+			}
+			require.Equal(required, err.Error(), testCaseName)
+			continue
+		}
+
+		// the port is written to the lock file once the Server listens
+		var lock model.ServerLock
+		require.Eventually(func() bool {
+			lock, err = model.ReadServerLock(path)
+			return err == nil && lock.Port != 0
+		}, 2*time.Second, 10*time.Millisecond, testCaseName)
+		require.Equal(os.Getpid(), lock.PID, testCaseName)
+		require.Equal(srv.Addr().(*net.TCPAddr).Port, lock.Port, testCaseName)
+
+		// the client without a port discovers it in the lock file
+		res, err := client.NewClient(0).WithHost("127.0.0.1").WithLockFile(path).Start()
+		require.NoError(err, testCaseName)
+		require.Equal("running", res.State, testCaseName)
+
+		cancel()
+		require.NoError(<-done, testCaseName)
+		_, err = os.Stat(path)
+		require.True(os.IsNotExist(err), "the lock file is not removed, with %s", testCaseName)
+	}
+}
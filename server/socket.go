@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/DonBattery/dotkafx/log"
+)
+
+const (
+	// socketPermissions restrict the Unix domain socket to the user running the Server
+	socketPermissions = 0600
+	// staleSocketTimeout is how long Listen waits for an answer on an existing socket before it is considered stale
+	staleSocketTimeout = time.Second
+)
+
+// listenSocket listens on a Unix domain socket at the given path. A stale socket left behind by a crashed Server
+// is removed first, but a socket with a live Server behind it, or a file which is not a socket, is never touched.
+func listenSocket(path string) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the umask of the process is not changed, since it would affect the files created by the other goroutines
+	if err := os.Chmod(path, socketPermissions); err != nil {
+		_ = lis.Close()
+		return nil, fmt.Errorf("Failed to restrict the permissions of the socket %s: %s", path, err)
+	}
+
+	return lis, nil
+}
+
+// removeStaleSocket removes the socket at the given path if nothing is listening on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("The socket path %s exists and it is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, staleSocketTimeout); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("Another Server is already listening on the socket %s", path)
+	}
+
+	log.Warn("Removing stale socket %s", path)
+	return os.Remove(path)
+}
+
+// peer returns the remote address of the connection for the logs. The clients of a Unix domain socket are unnamed.
+func peer(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" {
+		return addr.String()
+	}
+	return "local socket client"
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/DonBattery/dotkafx/bus"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// sseBuffer is the number of Notifications buffered for a slow SSE client before they get dropped
+	sseBuffer = 64
+	// sseKeepAlive is the interval of the comments sent to keep the idle SSE connections open
+	sseKeepAlive = 15 * time.Second
+)
+
+// writeSSE writes a Notification as a Server-Sent Event, the name of the event is the kind of the Notification.
+func writeSSE(w http.ResponseWriter, notification model.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", notification.Kind, data)
+	return err
+}
+
+// handleStream streams the Notifications of the Scheduler as Server-Sent Events until the client disconnects.
+// The first event is a snapshot of the current state.
+func (srv *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !srv.allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		srv.writeError(w, model.NewProtocolError(model.ErrorCodeInternal, "Streaming is not supported"))
+		return
+	}
+
+	notifications, unsubscribe := srv.sch.Bus.Subscribe("SSE client "+r.RemoteAddr, sseBuffer, bus.DropOldest)
+	defer unsubscribe()
+
+	log.Debug("SSE client connected: %s", r.RemoteAddr)
+	defer log.Debug("SSE client disconnected: %s", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeSSE(w, srv.sch.Snapshot()); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case notification, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, notification); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+
+	"github.com/DonBattery/dotkafx/bus"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+// watchBuffer is the number of Notifications buffered for a slow watch client before they get dropped
+const watchBuffer = 64
+
+// watch streams the Notifications of the Scheduler on the connection, one line each, until the client disconnects
+// or the context is done. The first line is a snapshot of the current state. A JSON client gets the Notifications
+// encoded as JSON, a text client gets them as human readable lines. The tick Notifications are only streamed if
+// ticks is set.
+func (srv *Server) watch(ctx context.Context, conn net.Conn, isJSON bool, ticks bool) {
+	notifications, unsubscribe := srv.sch.Bus.Subscribe("Watch client "+peer(conn), watchBuffer, bus.DropOldest)
+	defer unsubscribe()
+
+	log.Debug("Watch client connected: %s", peer(conn))
+	defer log.Debug("Watch client disconnected: %s", peer(conn))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the client sends nothing after its request, so the read only returns when it disconnects
+	go func() {
+		defer cancel()
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	if !srv.writeNotification(conn, isJSON, srv.sch.Snapshot()) {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification, ok := <-notifications:
+			if !ok {
+				return
+			}
+			if notification.Kind == model.NotificationTick && !ticks {
+				continue
+			}
+			if !srv.writeNotification(conn, isJSON, notification) {
+				return
+			}
+		}
+	}
+}
+
+// writeNotification writes a Notification line to a watch client, it returns false if the stream should end.
+func (srv *Server) writeNotification(conn net.Conn, isJSON bool, notification model.Notification) bool {
+	line := notification.String()
+	if isJSON {
+		data, err := json.Marshal(notification)
+		if err != nil {
+			log.Error("Failed to encode Notification: %s", err)
+			return false
+		}
+		line = string(data)
+	}
+
+	if srv.cmd.ReadTimeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(srv.cmd.ReadTimeout)); err != nil {
+			return false
+		}
+	}
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		log.Debug("Failed to write Notification to watch client %s: %s", peer(conn), err)
+		return false
+	}
+	return true
+}
@@ -1,13 +1,17 @@
 package sound
 
 import (
-	"dotkafx/log"
-	"dotkafx/model"
-	"embed"
+	"context"
 	"fmt"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/faiface/beep"
@@ -17,6 +21,7 @@ import (
 
 const (
 	embeddedSoundsFolder        = "embedded_sounds"
+	EmbeddedSource              = "embedded"
 	ChaosDunk                   = "chaos_dunk"
 	DotkaFXSercerIsOnline       = "dotkafx_server_is_online"
 	DotkaFXServerIsShuttingDown = "dotkafx_server_is_shutting_down"
@@ -27,67 +32,170 @@ const (
 	SchedulerStopped            = "scheduler_stopped"
 	SchedulerRolledBackward     = "scheduler_rolled_backward"
 	SchedulerRolledForward      = "scheduler_rolled_forward"
+	// resampleQuality is the quality of the resampling of the sounds which do not match the SpeakerFormat
+	resampleQuality = 4
 )
 
+// SpeakerFormat is the Format the speaker is initialized with. Every sound is resampled to it when it gets loaded,
+// no matter the sample rate of its mp3 file.
+var SpeakerFormat = beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+
 type Player struct {
-	embedded embed.FS
-	format   beep.Format
-	sounds   map[string]*beep.Buffer
+	embedded   fs.FS
+	soundPacks []string
+	sounds     map[string]*beep.Buffer
+	sources    map[string]string
+	// measured are the Catalog entries of the sounds which are not loaded, so each of them is decoded only once
+	measured map[string]model.SoundInfo
+	// speakerReady tells whether the speaker is initialized, so the sounds can actually be heard
+	speakerReady bool
+	mu           sync.RWMutex
 }
 
-func NewPlayer(embedded embed.FS) *Player {
+// NewPlayer creates a new Player. Sound names are searched in the soundPacks directories (in order)
+// before falling back to the embedded sounds.
+func NewPlayer(embedded fs.FS, soundPacks []string) *Player {
 	return &Player{
-		embedded: embedded,
-		sounds:   make(map[string]*beep.Buffer),
+		embedded:   embedded,
+		soundPacks: soundPacks,
+		sounds:     make(map[string]*beep.Buffer),
+		sources:    make(map[string]string),
+		measured:   make(map[string]model.SoundInfo),
 	}
 }
 
-func (player *Player) loadFromReadCloser(name string, rc io.ReadCloser) error {
+// decode reads the whole mp3 stream into a Buffer with the SpeakerFormat, resampling it if needed.
+func decode(rc io.ReadCloser) (*beep.Buffer, error) {
 	streamer, format, err := mp3.Decode(rc)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer streamer.Close()
+
+	buffer := beep.NewBuffer(SpeakerFormat)
+	if format.SampleRate == SpeakerFormat.SampleRate {
+		buffer.Append(streamer)
+	} else {
+		buffer.Append(beep.Resample(resampleQuality, format.SampleRate, SpeakerFormat.SampleRate, streamer))
+	}
+
+	return buffer, nil
+}
+
+// resolve returns the source of a sound name and opens it. If the name ends with .mp3 it is a filesystem path,
+// otherwise the SoundPacks are searched in order, and finally the embedded sounds.
+func (player *Player) resolve(name string) (source string, rc io.ReadCloser, err error) {
+	if strings.HasSuffix(name, ".mp3") {
+		rc, err = os.Open(name)
+		return name, rc, err
+	}
+
+	for _, soundPack := range player.soundPacks {
+		path := filepath.Join(soundPack, name+".mp3")
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		rc, err = os.Open(path)
+		return path, rc, err
+	}
+
+	rc, err = player.embedded.Open(fmt.Sprintf("%s/%s.mp3", embeddedSoundsFolder, name))
+	return EmbeddedSource, rc, err
+}
+
+// read resolves the sound name and decodes it into a Buffer, or generates it if it is a tone.
+func (player *Player) read(name string) (source string, buffer *beep.Buffer, err error) {
+	if IsTone(name) {
+		buffer, err = generateTone(name, SpeakerFormat)
+		return GeneratedSource, buffer, err
 	}
 
-	player.format = format
+	source, file, err := player.resolve(name)
+	if err != nil {
+		return source, nil, err
+	}
+	defer file.Close()
+
+	buffer, err = decode(file)
+	if err != nil {
+		return source, nil, fmt.Errorf("Failed to decode sound %s from %s: %s", name, source, err)
+	}
+
+	return source, buffer, nil
+}
 
-	buffer := beep.NewBuffer(format)
-	buffer.Append(streamer)
-	streamer.Close()
+// loadSound loads an mp3 file (or generates a tone) into the Player's memory.
+func (player *Player) loadSound(name string) (*beep.Buffer, error) {
+	source, buffer, err := player.read(name)
+	if err != nil {
+		return nil, err
+	}
+
+	player.mu.Lock()
+	defer player.mu.Unlock()
 
 	player.sounds[name] = buffer
+	player.sources[name] = source
+	log.Debug("Sound %s loaded from %s", name, source)
 
-	return nil
+	return buffer, nil
 }
 
-// loadSound loads an mp3 file into the Player's memory. If it ends with .mp3 we try to load it from the filesystem path,
-// if not we will try to load it from the embedded sounds.
-func (player *Player) loadSound(name string) error {
-	if strings.HasSuffix(name, ".mp3") {
-		file, err := os.Open(name)
+// checkSoundPacks makes sure every SoundPack is an existing directory.
+func (player *Player) checkSoundPacks() error {
+	for _, soundPack := range player.soundPacks {
+		info, err := os.Stat(soundPack)
 		if err != nil {
-			return err
+			return fmt.Errorf("Failed to open SoundPack: %s", err)
 		}
-		defer file.Close()
-		return player.loadFromReadCloser(name, file)
+		if !info.IsDir() {
+			return fmt.Errorf("The SoundPack %s is not a directory", soundPack)
+		}
+	}
+	return nil
+}
+
+func (player *Player) LoadSoundsAndInitSpeaker(profile model.ConfigProfile) error {
+	if err := player.LoadSounds(profile); err != nil {
+		return err
 	}
 
-	file, err := player.embedded.Open(fmt.Sprintf("%s/%s.mp3", embeddedSoundsFolder, name))
-	if err != nil {
+	if err := speaker.Init(SpeakerFormat.SampleRate, SpeakerFormat.SampleRate.N(time.Second/10)); err != nil {
 		return err
 	}
-	defer file.Close()
-	return player.loadFromReadCloser(name, file)
+
+	player.mu.Lock()
+	player.speakerReady = true
+	player.mu.Unlock()
+	return nil
 }
 
-func (player *Player) LoadSoundsAndInitSpeaker(profile model.ConfigProfile) error {
+// CloseSpeaker stops the playback and closes the speaker.
+func (player *Player) CloseSpeaker() {
+	player.mu.Lock()
+	defer player.mu.Unlock()
+
+	if player.speakerReady {
+		speaker.Close()
+		player.speakerReady = false
+	}
+}
+
+// LoadSounds loads every SoundEffect used by the Profile, and the built-in sounds of the Server into memory.
+func (player *Player) LoadSounds(profile model.ConfigProfile) error {
+	if err := player.checkSoundPacks(); err != nil {
+		return err
+	}
+
 	for soundEffect := range profile.AllSoundEffect() {
-		if err := player.loadSound(soundEffect); err != nil {
+		if _, err := player.loadSound(soundEffect); err != nil {
 			return err
 		}
 	}
 
 	for _, soundEffect := range []string{
 		ChaosDunk,
+		CountdownTick,
 		DotkaFXSercerIsOnline,
 		DotkaFXServerIsShuttingDown,
 		SchedulerPaused,
@@ -98,16 +206,18 @@ func (player *Player) LoadSoundsAndInitSpeaker(profile model.ConfigProfile) erro
 		SchedulerRolledBackward,
 		SchedulerRolledForward,
 	} {
-		if err := player.loadSound(soundEffect); err != nil {
+		if _, err := player.loadSound(soundEffect); err != nil {
 			return err
 		}
 	}
 
-	return speaker.Init(player.format.SampleRate, player.format.SampleRate.N(time.Second/10))
+	return nil
 }
 
 func (player *Player) Play(name string) {
+	player.mu.RLock()
 	fx, ok := player.sounds[name]
+	player.mu.RUnlock()
 	if !ok {
 		return
 	}
@@ -116,9 +226,229 @@ func (player *Player) Play(name string) {
 	speaker.Play(sound)
 }
 
+// PlayAndWait plays a loaded sound and waits until it is finished or the context is done.
+// It returns right away if the sound is not loaded or the speaker is not initialized.
+func (player *Player) PlayAndWait(ctx context.Context, name string) error {
+	player.mu.RLock()
+	fx, ok := player.sounds[name]
+	ready := player.speakerReady
+	player.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("Sound is not loaded: %s", name)
+	}
+	if !ready {
+		return fmt.Errorf("The speaker is not initialized")
+	}
+
+	done := make(chan struct{})
+	log.Debug("SoundPlayer is now playing: %s", name)
+	speaker.Play(beep.Seq(fx.Streamer(0, fx.Len()), beep.Callback(func() {
+		close(done)
+	})))
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PlaySound plays a loaded sound, or a sound of the SoundPacks, an embedded sound or a tone, which is read for
+// this time only, so the sounds requested by the clients do not pile up in memory. Unlike the SoundEffects of the
+// config, the name cannot be a path, so the clients cannot open any other file. It returns the duration of the sound.
+func (player *Player) PlaySound(name string) (time.Duration, error) {
+	player.mu.RLock()
+	fx, ok := player.sounds[name]
+	player.mu.RUnlock()
+	if !ok {
+		if err := player.checkResolvable(name); err != nil {
+			return 0, err
+		}
+		var err error
+		if _, fx, err = player.read(name); err != nil {
+			return 0, err
+		}
+	}
+	log.Debug("SoundPlayer is now playing: %s", name)
+	speaker.Play(fx.Streamer(0, fx.Len()))
+	return fx.Format().SampleRate.D(fx.Len()), nil
+}
+
+// checkResolvable makes sure the name is a tone, or the name of a sound of the SoundPacks or an embedded sound.
+func (player *Player) checkResolvable(name string) error {
+	if IsTone(name) {
+		// the tone is parsed when it is generated
+		return nil
+	}
+	if strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".mp3") || strings.Contains(name, "..") {
+		return fmt.Errorf("The sound name %s cannot be a path", name)
+	}
+
+	names, err := player.resolvableNames()
+	if err != nil {
+		return err
+	}
+	if !names[name] {
+		return fmt.Errorf("Unknown sound: %s", name)
+	}
+	return nil
+}
+
+// Durations returns the duration of every loaded sound.
+func (player *Player) Durations() map[string]time.Duration {
+	player.mu.RLock()
+	defer player.mu.RUnlock()
+
+	durations := map[string]time.Duration{}
+	for name, buffer := range player.sounds {
+		durations[name] = buffer.Format().SampleRate.D(buffer.Len())
+	}
+	return durations
+}
+
+// Format returns the Format the speaker is initialized with, which is the Format of every loaded sound.
+func (player *Player) Format() beep.Format {
+	return SpeakerFormat
+}
+
+// Clip returns a new Streamer of a loaded sound together with the Format of the sound.
+func (player *Player) Clip(name string) (beep.StreamSeeker, beep.Format, bool) {
+	player.mu.RLock()
+	fx, ok := player.sounds[name]
+	player.mu.RUnlock()
+	if !ok {
+		return nil, beep.Format{}, false
+	}
+	return fx.Streamer(0, fx.Len()), fx.Format(), true
+}
+
 func (player *Player) Names() (names []string) {
+	player.mu.RLock()
+	defer player.mu.RUnlock()
 	for key := range player.sounds {
 		names = append(names, key)
 	}
 	return
 }
+
+// resolvableNames collects the names of every mp3 file found in the SoundPacks and the embedded sounds,
+// and the named tone patterns.
+func (player *Player) resolvableNames() (names map[string]bool, err error) {
+	names = map[string]bool{}
+
+	collect := func(entries []fs.DirEntry) {
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".mp3") {
+				continue
+			}
+			names[strings.TrimSuffix(entry.Name(), ".mp3")] = true
+		}
+	}
+
+	for _, soundPack := range player.soundPacks {
+		entries, err := os.ReadDir(soundPack)
+		if err != nil {
+			return nil, err
+		}
+		collect(entries)
+	}
+
+	entries, err := fs.ReadDir(player.embedded, embeddedSoundsFolder)
+	if err != nil {
+		return nil, err
+	}
+	collect(entries)
+
+	for pattern := range tonePatterns {
+		names[tonePrefix+pattern] = true
+	}
+
+	// the SoundEffects loaded from the config (filesystem paths and custom tones) are resolvable as well
+	for _, name := range player.Names() {
+		names[name] = true
+	}
+
+	return names, nil
+}
+
+// Catalog returns every resolvable sound name sorted by name, with its source (SoundPack file path or embedded)
+// and its duration. Sounds which are not loaded yet are decoded to measure their duration, the first time only.
+func (player *Player) Catalog() ([]model.SoundInfo, error) {
+	names, err := player.resolvableNames()
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := []model.SoundInfo{}
+	for name := range names {
+		info, err := player.soundInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		catalog = append(catalog, info)
+	}
+
+	sort.Slice(catalog, func(i, j int) bool {
+		return catalog[i].Name < catalog[j].Name
+	})
+
+	return catalog, nil
+}
+
+// soundInfo returns the Catalog entry of a sound. A sound which is not loaded is decoded and measured once,
+// without keeping it in memory.
+func (player *Player) soundInfo(name string) (model.SoundInfo, error) {
+	player.mu.RLock()
+	buffer, loaded := player.sounds[name]
+	source := player.sources[name]
+	info, measured := player.measured[name]
+	player.mu.RUnlock()
+	if measured {
+		return info, nil
+	}
+
+	if !loaded {
+		var err error
+		if source, buffer, err = player.read(name); err != nil {
+			return model.SoundInfo{}, err
+		}
+	}
+	info = model.SoundInfo{
+		Name:     name,
+		Source:   source,
+		Duration: buffer.Format().SampleRate.D(buffer.Len()).Milliseconds(),
+	}
+	if !loaded {
+		player.mu.Lock()
+		player.measured[name] = info
+		player.mu.Unlock()
+	}
+	return info, nil
+}
+
+// NotificationSound returns the name of the sound to be played for a Notification of the Scheduler.
+func NotificationSound(notification model.Notification) (string, bool) {
+	switch notification.Kind {
+	case model.NotificationTimelineEvent:
+		return notification.SoundEffect, true
+	case model.NotificationCountdown:
+		return CountdownTick, true
+	case model.NotificationStarted:
+		return SchedulerStarted, true
+	case model.NotificationRestarted:
+		return SchedulerRestarted, true
+	case model.NotificationPaused:
+		return SchedulerPaused, true
+	case model.NotificationResumed:
+		return SchedulerResumed, true
+	case model.NotificationStopped:
+		return SchedulerStopped, true
+	case model.NotificationRolledBack:
+		return SchedulerRolledBackward, true
+	case model.NotificationRolledForward:
+		return SchedulerRolledForward, true
+	default:
+		return "", false
+	}
+}
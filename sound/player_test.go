@@ -0,0 +1,142 @@
+package sound_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/mp3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/sound"
+)
+
+// sourceLength decodes the mp3 file as it is, without resampling, and returns its sample rate and length.
+func sourceLength(t *testing.T, path string) (beep.SampleRate, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamer, format, err := mp3.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer streamer.Close()
+	return format.SampleRate, streamer.Len()
+}
+
+func TestLoadSoundsResamples(t *testing.T) {
+	require := assert.New(t)
+
+	// the embedded sounds are looked up in the embedded_sounds folder of the repository
+	player := sound.NewPlayer(os.DirFS(".."), []string{filepath.Join("testdata", "pack")})
+	profile := model.ConfigProfile{
+		Events: map[string]model.Event{
+			"silence":  {SoundEffect: "silence_44100"},
+			"morning":  {SoundEffect: "good_morning"},
+			"beep":     {SoundEffect: "tone:double"},
+			"duration": {SoundEffect: "tone:440hz:500ms"},
+		},
+	}
+	require.NoError(player.LoadSounds(profile))
+	require.Equal(sound.SpeakerFormat, player.Format())
+
+	for name, path := range map[string]string{
+		"silence_44100":             filepath.Join("testdata", "pack", "silence_44100.mp3"),
+		"good_morning":              filepath.Join("..", "embedded_sounds", "good_morning.mp3"),
+		sound.SchedulerStarted:      filepath.Join("..", "embedded_sounds", "scheduler_started.mp3"),
+		sound.DotkaFXSercerIsOnline: filepath.Join("..", "embedded_sounds", "dotkafx_server_is_online.mp3"),
+	} {
+		t.Logf("Testing LoadSounds, with %s", name)
+		rate, length := sourceLength(t, path)
+
+		clip, format, ok := player.Clip(name)
+		require.True(ok)
+		require.Equal(sound.SpeakerFormat, format)
+		require.InDelta(sound.SpeakerFormat.SampleRate.N(rate.D(length)), clip.Len(), 2)
+	}
+
+	for name, duration := range map[string]int{
+		"tone:double":       sound.SpeakerFormat.SampleRate.N(400 * time.Millisecond),
+		"tone:440hz:500ms":  sound.SpeakerFormat.SampleRate.N(500 * time.Millisecond),
+		sound.CountdownTick: sound.SpeakerFormat.SampleRate.N(60 * time.Millisecond),
+	} {
+		t.Logf("Testing LoadSounds, with %s", name)
+		clip, format, ok := player.Clip(name)
+		require.True(ok)
+		require.Equal(sound.SpeakerFormat, format)
+		require.Equal(duration, clip.Len())
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	require := assert.New(t)
+
+	player := sound.NewPlayer(os.DirFS(".."), []string{filepath.Join("testdata", "pack")})
+	catalog, err := player.Catalog()
+	require.NoError(err)
+
+	infos := map[string]model.SoundInfo{}
+	for _, info := range catalog {
+		infos[info.Name] = info
+	}
+	require.Equal(model.SoundInfo{Name: "tone:tick", Source: sound.GeneratedSource, Duration: 60}, infos["tone:tick"])
+	require.Equal(model.SoundInfo{Name: "good_morning", Source: sound.EmbeddedSource, Duration: 1123}, infos["good_morning"])
+	require.Equal(model.SoundInfo{
+		Name:     "silence_44100",
+		Source:   filepath.Join("testdata", "pack", "silence_44100.mp3"),
+		Duration: 992,
+	}, infos["silence_44100"])
+
+	// the sounds which are not loaded are measured once, a changed file is not decoded again
+	pack := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "pack", "silence_44100.mp3"))
+	require.NoError(err)
+	path := filepath.Join(pack, "silence.mp3")
+	require.NoError(os.WriteFile(path, data, 0600))
+	player = sound.NewPlayer(os.DirFS(".."), []string{pack})
+	for i := 0; i < 2; i++ {
+		catalog, err = player.Catalog()
+		require.NoError(err)
+		require.Contains(catalog, model.SoundInfo{Name: "silence", Source: path, Duration: 992})
+		require.NoError(os.WriteFile(path, []byte("not an mp3"), 0600))
+	}
+}
+
+func TestPlaySound(t *testing.T) {
+	require := assert.New(t)
+
+	player := sound.NewPlayer(os.DirFS(".."), []string{filepath.Join("testdata", "pack")})
+
+	testCases := map[string]struct {
+		name          string
+		requiredError string
+	}{
+		"packSound":     {"silence_44100", ""},
+		"embeddedSound": {"good_morning", ""},
+		"tone":          {"tone:440hz:50ms", ""},
+		"invalidTone":   {"tone:5hz:50ms", "The tone frequency in tone:5hz:50ms must be between 20hz and 20000hz"},
+		"unknown":       {"bad_morning", "Unknown sound: bad_morning"},
+		"filePath":      {filepath.Join("testdata", "pack", "silence_44100.mp3"), "cannot be a path"},
+		"outOfThePack":  {"../pack/silence_44100", "cannot be a path"},
+		"parentFolder":  {"..", "cannot be a path"},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing PlaySound, with %s", testCaseName)
+
+		_, err := player.PlaySound(testCase.name)
+		if testCase.requiredError == "" {
+			require.NoError(err, testCaseName)
+			continue
+		}
+		require.Error(err, testCaseName)
+		require.Contains(err.Error(), testCase.requiredError, testCaseName)
+	}
+
+	// the sounds requested by the clients are not kept in memory
+	require.Empty(player.Names())
+}
@@ -0,0 +1,100 @@
+package sound
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/generators"
+)
+
+const (
+	tonePrefix      = "tone:"
+	GeneratedSource = "generated"
+	// CountdownTick is the sound played in the last seconds before an Event with CountdownBeeps
+	CountdownTick = "tone:tick"
+	// toneGain lowers the volume of the generated tones, so they are not louder than the recorded clips
+	toneGain = -0.7
+)
+
+// toneStep is a part of a generated tone, a sine wave with the given frequency, or silence if the frequency is 0.
+type toneStep struct {
+	frequency int
+	duration  time.Duration
+}
+
+// tonePatterns are the named beep patterns which can be used as SoundEffect (e.g. "tone:double").
+var tonePatterns = map[string][]toneStep{
+	"single": {{880, 200 * time.Millisecond}},
+	"double": {{880, 150 * time.Millisecond}, {0, 100 * time.Millisecond}, {880, 150 * time.Millisecond}},
+	"rising": {{660, 120 * time.Millisecond}, {0, 40 * time.Millisecond}, {880, 120 * time.Millisecond}, {0, 40 * time.Millisecond}, {1100, 160 * time.Millisecond}},
+	"tick":   {{1200, 60 * time.Millisecond}},
+}
+
+// IsTone tells if the sound name refers to a generated tone instead of an mp3 file.
+func IsTone(name string) bool {
+	return strings.HasPrefix(name, tonePrefix)
+}
+
+// parseTone parses a tone sound name, which is either a named pattern like "tone:rising",
+// or a frequency and a duration like "tone:880hz:200ms".
+func parseTone(name string) ([]toneStep, error) {
+	spec := strings.TrimPrefix(name, tonePrefix)
+
+	if pattern, ok := tonePatterns[spec]; ok {
+		return pattern, nil
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 || !strings.HasSuffix(strings.ToLower(parts[0]), "hz") {
+		return nil, fmt.Errorf("Invalid tone: %s (use tone:<frequency>hz:<duration> or one of the patterns: single, double, rising, tick)", name)
+	}
+
+	frequency, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(parts[0]), "hz"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid tone frequency in %s: %s", name, err)
+	}
+	if frequency < 20 || frequency > 20000 {
+		return nil, fmt.Errorf("The tone frequency in %s must be between 20hz and 20000hz", name)
+	}
+
+	duration, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid tone duration in %s: %s", name, err)
+	}
+	if duration < 10*time.Millisecond || duration > 10*time.Second {
+		return nil, fmt.Errorf("The tone duration in %s must be between 10ms and 10s", name)
+	}
+
+	return []toneStep{{frequency, duration}}, nil
+}
+
+// generateTone renders the tone into a Buffer with the given Format.
+func generateTone(name string, format beep.Format) (*beep.Buffer, error) {
+	steps, err := parseTone(name)
+	if err != nil {
+		return nil, err
+	}
+
+	streamers := []beep.Streamer{}
+	for _, step := range steps {
+		samples := format.SampleRate.N(step.duration)
+		if step.frequency == 0 {
+			streamers = append(streamers, beep.Silence(samples))
+			continue
+		}
+		tone, err := generators.SinTone(format.SampleRate, step.frequency)
+		if err != nil {
+			return nil, err
+		}
+		streamers = append(streamers, beep.Take(samples, &effects.Gain{Streamer: tone, Gain: toneGain}))
+	}
+
+	buffer := beep.NewBuffer(format)
+	buffer.Append(beep.Seq(streamers...))
+
+	return buffer, nil
+}
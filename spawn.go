@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/log"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// spawnTimeout is the time a spawned Server has to load its sounds and respond
+	spawnTimeout = 20 * time.Second
+	// spawnPollInterval is the wait between two checks whether the spawned Server responds
+	spawnPollInterval = 250 * time.Millisecond
+	// spawnLogFile is the file in the temp folder the output of a spawned Server is written to
+	spawnLogFile = "dotkafx_server.log"
+)
+
+// localHosts are the hosts a Server can be spawned for
+var localHosts = map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+
+// ensureServer starts the Server in the background if it is not reachable, and waits until it responds.
+func ensureServer(cli *client.Client, cmd model.RootCommand) error {
+	var connectErr *client.ConnectError
+	if _, err := cli.Status(0); !errors.As(err, &connectErr) {
+		return nil
+	}
+	if cmd.Socket == "" && !localHosts[cmd.Host] {
+		return fmt.Errorf("The Server can only be spawned on this machine, not on %s", cmd.Host)
+	}
+
+	exited, err := spawnServer(cmd)
+	if err != nil {
+		return fmt.Errorf("Failed to spawn the Server: %s", err)
+	}
+
+	timeout := time.After(spawnTimeout)
+	for {
+		_, err := cli.Status(0)
+		if !errors.As(err, &connectErr) {
+			return nil
+		}
+		select {
+		case exitErr := <-exited:
+			return fmt.Errorf("The spawned Server exited (%v), see %s for the details: %w", exitErr, filepath.Join(os.TempDir(), spawnLogFile), err)
+		case <-timeout:
+			return fmt.Errorf("The spawned Server did not respond within %s: %w", spawnTimeout, err)
+		case <-time.After(spawnPollInterval):
+		}
+	}
+}
+
+// spawnServer starts this executable as a Server in the background, with the Server options of the command.
+// The returned channel receives the result of the Server if it exits while the client is still running.
+func spawnServer(cmd model.RootCommand) (<-chan error, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	logPath := filepath.Join(os.TempDir(), spawnLogFile)
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	server := exec.Command(executable, serverArgs(cmd)...)
+	server.Stdout = logFile
+	server.Stderr = logFile
+	// the token is passed in the environment, so it does not show up in the process list
+	server.Env = append(os.Environ(), "DOTKAFX_TOKEN="+cmd.Token)
+	detach(server)
+
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	log.Info("DotkaFX Server spawned (pid %d), its output goes to %s", server.Process.Pid, logPath)
+
+	// the Server is detached, so it keeps running when the client exits
+	exited := make(chan error, 1)
+	go func() {
+		exited <- server.Wait()
+	}()
+	return exited, nil
+}
+
+// serverArgs returns the command line options of a Server with the settings of the command.
+func serverArgs(cmd model.RootCommand) []string {
+	args := []string{
+		"--config-profile-name", cmd.ConfigProfileName,
+		"--port", strconv.Itoa(cmd.Port),
+		"--lock-file", cmd.LockFile,
+		"--listen", cmd.Listen,
+		"--max-connections", strconv.Itoa(cmd.MaxConnections),
+		"--read-timeout", cmd.ReadTimeout.String(),
+	}
+	if cmd.Socket != "" {
+		args = append(args, "--socket", cmd.Socket)
+	}
+	if cmd.NoTCP {
+		args = append(args, "--no-tcp")
+	}
+	if cmd.HTTPPort > 0 {
+		args = append(args, "--http-port", strconv.Itoa(cmd.HTTPPort))
+	}
+	if cmd.Debug {
+		args = append(args, "--debug")
+	}
+	return args
+}
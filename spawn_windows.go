@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachedProcess is the DETACHED_PROCESS creation flag, the spawned Server gets no console
+const detachedProcess = 0x00000008
+
+// detach runs the spawned Server without a console in a new process group, so it does not get the Ctrl+C of
+// the console of the client.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
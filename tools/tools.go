@@ -61,3 +61,37 @@ func StringToSeconds(input string) (int, error) {
 	}
 	return int(val.Seconds()), nil
 }
+
+// ClockToSeconds converts a game clock like "20:00", "1:02:03" or "-0:45" into seconds.
+// If the input is not a clock it is parsed as a duration with StringToSeconds.
+func ClockToSeconds(input string) (int, error) {
+	if !strings.Contains(input, ":") {
+		return StringToSeconds(input)
+	}
+
+	sign := 1
+	clock := input
+	if strings.HasPrefix(clock, "-") {
+		sign = -1
+		clock = strings.TrimPrefix(clock, "-")
+	}
+
+	parts := strings.Split(clock, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("Invalid game clock: %s", input)
+	}
+
+	seconds := 0
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("Invalid game clock: %s", input)
+		}
+		if i > 0 && value > 59 {
+			return 0, fmt.Errorf("Invalid game clock: %s", input)
+		}
+		seconds = seconds*60 + value
+	}
+
+	return sign * seconds, nil
+}
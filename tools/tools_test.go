@@ -5,7 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
-	"dotkafx/tools"
+	"github.com/DonBattery/dotkafx/tools"
 )
 
 func TestSecondsToString(t *testing.T) {
@@ -213,3 +213,70 @@ func TestParseSuffixAmount(t *testing.T) {
 		}
 	}
 }
+
+func TestClockToSeconds(t *testing.T) {
+	require := assert.New(t)
+
+	testCases := map[string]struct {
+		input          string
+		requiredOutput int
+		requiredError  string
+	}{
+		"minutesAndSeconds": {
+			"20:00",
+			1200,
+			"",
+		},
+		"shortMinutes": {
+			"0:05",
+			5,
+			"",
+		},
+		"hoursMinutesAndSeconds": {
+			"1:02:03",
+			3723,
+			"",
+		},
+		"negativeClock": {
+			"-0:45",
+			-45,
+			"",
+		},
+		"duration": {
+			"1m30s",
+			90,
+			"",
+		},
+		"integer": {
+			"90",
+			90,
+			"",
+		},
+		"tooManyParts": {
+			"1:00:00:00",
+			0,
+			"Invalid game clock: 1:00:00:00",
+		},
+		"invalidSeconds": {
+			"1:75",
+			0,
+			"Invalid game clock: 1:75",
+		},
+		"invalidPart": {
+			"1:xx",
+			0,
+			"Invalid game clock: 1:xx",
+		},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing ClockToSeconds, with %s", testCaseName)
+		actualOutput, actualError := tools.ClockToSeconds(testCase.input)
+		require.Equal(testCase.requiredOutput, actualOutput)
+		if testCase.requiredError == "" {
+			require.NoError(actualError)
+		} else {
+			require.EqualError(actualError, testCase.requiredError)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/DonBattery/dotkafx/client"
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// upcomingEvents is the number of upcoming events fetched from the Server, the dashboard shows as many as fit
+	upcomingEvents = 20
+	// defaultWidth and defaultHeight are used if the size of the terminal is unknown
+	defaultWidth  = 80
+	defaultHeight = 24
+)
+
+// ANSI escape sequences of the dashboard
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	home           = "\x1b[H"
+	clearLine      = "\x1b[K"
+	clearBelow     = "\x1b[J"
+)
+
+// keys maps the keys of the dashboard to the commands sent to the Server
+var keys = map[string]string{
+	"s":      "start",
+	"p":      "pause",
+	" ":      "pause",
+	"b":      "back 10",
+	"f":      "forward 10",
+	"<":      "back 1",
+	">":      "forward 1",
+	"\x1b[D": "back 1",
+	"\x1b[C": "forward 1",
+}
+
+// Run shows the dashboard on the terminal until q (or Ctrl+C) is pressed, the context is done or the Server
+// shuts down. The commands are sent on a Session, the dashboard is refreshed on every Notification of the Server.
+func Run(ctx context.Context, cli *client.Client, in *os.File, out *os.File) error {
+	if !term.IsTerminal(int(in.Fd())) {
+		return errors.New("The dashboard needs a terminal")
+	}
+
+	session, err := cli.Session()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = term.Restore(int(in.Fd()), state)
+	}()
+
+	fmt.Fprint(out, enterAltScreen)
+	defer fmt.Fprint(out, leaveAltScreen)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	notifications := make(chan model.Notification, 64)
+	watched := make(chan error, 1)
+	go func() {
+		defer cancel()
+		watched <- cli.Watch(ctx, true, func(notification model.Notification) {
+			select {
+			case notifications <- notification:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	// the reading of the keys cannot be interrupted, it ends together with the process
+	pressed := make(chan string)
+	go readKeys(in, pressed)
+
+	view := View{}
+	refresh := func() {
+		res, err := session.Do(model.Request{Command: "status", Events: upcomingEvents})
+		if err != nil {
+			view.Message = err.Error()
+			return
+		}
+		view.State = res.State
+		view.GameTime = res.GameTime
+		view.Upcoming = res.NextEvents
+		if res.Status != nil {
+			view.Profile = res.Status.Profile
+		}
+	}
+	refresh()
+
+	for {
+		draw(out, in, view)
+
+		select {
+		case <-ctx.Done():
+			if err := <-watched; err != nil {
+				return err
+			}
+			return nil
+		case notification := <-notifications:
+			if notification.Kind == model.NotificationTimelineEvent {
+				view.Fire(notification)
+			}
+			refresh()
+		case key := <-pressed:
+			if key == "q" || key == "\x03" {
+				return nil
+			}
+			line, ok := keys[key]
+			if !ok {
+				continue
+			}
+			res, err := session.Send(line)
+			var protoErr *model.ProtocolError
+			switch {
+			case errors.As(err, &protoErr):
+				view.Message = protoErr.Message
+			case err != nil:
+				return err
+			default:
+				view.Message = res.Message
+			}
+			refresh()
+		}
+	}
+}
+
+// readKeys sends every key (or escape sequence) read from the terminal to the channel.
+func readKeys(in io.Reader, pressed chan<- string) {
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		pressed <- string(buf[:n])
+	}
+}
+
+// draw renders the dashboard in the current size of the terminal.
+func draw(out io.Writer, in *os.File, view View) {
+	width, height, err := term.GetSize(int(in.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = defaultWidth, defaultHeight
+	}
+
+	var screen strings.Builder
+	screen.WriteString(home)
+	for i, line := range view.Render(width, height) {
+		if i > 0 {
+			screen.WriteString("\r\n")
+		}
+		screen.WriteString(line + clearLine)
+	}
+	screen.WriteString(clearBelow)
+	fmt.Fprint(out, screen.String())
+}
@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DonBattery/dotkafx/model"
+)
+
+const (
+	// barHorizon is the time until an event at which its countdown bar starts to fill
+	barHorizon = 5 * 60
+	// maxBarWidth is the maximum width of a countdown bar
+	maxBarWidth = 30
+	// firedEvents is the number of the last fired events on the dashboard
+	firedEvents = 5
+	// bigClockWidth and bigClockHeight are the minimum size of the terminal for the big game clock
+	bigClockWidth  = 40
+	bigClockHeight = 16
+)
+
+// font is the 3x5 font of the big game clock
+var font = map[rune][5]string{
+	'0': {"###", "# #", "# #", "# #", "###"},
+	'1': {"  #", "  #", "  #", "  #", "  #"},
+	'2': {"###", "  #", "###", "#  ", "###"},
+	'3': {"###", "  #", "###", "  #", "###"},
+	'4': {"# #", "# #", "###", "  #", "  #"},
+	'5': {"###", "#  ", "###", "  #", "###"},
+	'6': {"###", "#  ", "###", "# #", "###"},
+	'7': {"###", "  #", "  #", "  #", "  #"},
+	'8': {"###", "# #", "###", "# #", "###"},
+	'9': {"###", "# #", "###", "  #", "###"},
+	':': {"   ", " # ", "   ", " # ", "   "},
+	'-': {"   ", "   ", "###", "   ", "   "},
+}
+
+// View is the content of the dashboard.
+type View struct {
+	Profile  string
+	State    string
+	GameTime int
+	Upcoming []model.UpcomingEvent
+	// Fired are the last fired events, the newest first
+	Fired []model.Notification
+	// Message is the response of the last command
+	Message string
+}
+
+// Fire adds a fired event to the View, keeping the last few of them.
+func (v *View) Fire(notification model.Notification) {
+	v.Fired = append([]model.Notification{notification}, v.Fired...)
+	if len(v.Fired) > firedEvents {
+		v.Fired = v.Fired[:firedEvents]
+	}
+}
+
+// clock returns the game clock without the hours if they are zero (e.g. "-01:00" or "12:30").
+func clock(gameTime int) string {
+	sign := ""
+	if gameTime < 0 {
+		sign = "-"
+		gameTime = -gameTime
+	}
+	if gameTime >= 3600 {
+		return fmt.Sprintf("%s%d:%02d:%02d", sign, gameTime/3600, gameTime/60%60, gameTime%60)
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, gameTime/60, gameTime%60)
+}
+
+// bigClock returns the lines of the game clock written with the big font.
+func bigClock(text string) []string {
+	lines := make([]string, 5)
+	for _, r := range text {
+		glyph, ok := font[r]
+		if !ok {
+			continue
+		}
+		for i := range lines {
+			lines[i] += glyph[i] + " "
+		}
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	return lines
+}
+
+// bar returns the countdown bar of an event which happens in the given seconds. The bar fills up as the event
+// gets closer.
+func bar(in int, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	filled := width
+	if in > 0 {
+		filled = width * (barHorizon - in) / barHorizon
+	}
+	if filled < 0 {
+		filled = 0
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+// truncate cuts the line to the width of the terminal.
+func truncate(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	return string([]rune(line)[:width])
+}
+
+// Render returns the lines of the dashboard for a terminal of the given size. On a small terminal the game clock
+// is written in a single line and the lists are shortened to fit.
+func (v View) Render(width int, height int) []string {
+	title := "DotkaFX  " + strings.ToUpper(v.State)
+	if v.Profile != "" {
+		title += "  Profile: " + v.Profile
+	}
+	header := []string{title, ""}
+	if width >= bigClockWidth && height >= bigClockHeight {
+		for _, line := range bigClock(clock(v.GameTime)) {
+			header = append(header, "  "+line)
+		}
+	} else {
+		header = append(header, "Game time: "+clock(v.GameTime))
+	}
+	header = append(header, "")
+
+	footer := []string{"", v.Message, "[s] start  [p] pause  [b/f] back/forward 10s  [</>] 1s  [q] quit"}
+
+	// the lists share the rows left between the header and the footer
+	rows := height - len(header) - len(footer) - 2
+	if rows < 0 {
+		rows = 0
+	}
+	fired := len(v.Fired)
+	if fired > rows/3 {
+		fired = rows / 3
+	}
+	upcoming := len(v.Upcoming)
+	if upcoming > rows-fired {
+		upcoming = rows - fired
+	}
+
+	lines := header
+	lines = append(lines, "Upcoming events:")
+	for _, event := range v.Upcoming[:upcoming] {
+		text := fmt.Sprintf("  %6s  %-20s in %-8s", clock(event.GameTime), event.Name, time.Duration(event.In)*time.Second)
+		barWidth := width - utf8.RuneCountInString(text) - 3
+		if barWidth > maxBarWidth {
+			barWidth = maxBarWidth
+		}
+		lines = append(lines, text+" "+bar(event.In, barWidth))
+	}
+	lines = append(lines, "Last events:")
+	for _, notification := range v.Fired[:fired] {
+		lines = append(lines, fmt.Sprintf("  %6s  %s", clock(notification.GameTime), notification.Event))
+	}
+	lines = append(lines, footer...)
+
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+	for i := range lines {
+		lines[i] = truncate(lines[i], width)
+	}
+	return lines
+}
@@ -0,0 +1,111 @@
+package tui_test
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DonBattery/dotkafx/model"
+	"github.com/DonBattery/dotkafx/tui"
+)
+
+func TestRender(t *testing.T) {
+	require := assert.New(t)
+
+	view := tui.View{
+		Profile:  "test",
+		State:    "running",
+		GameTime: 150,
+		Upcoming: []model.UpcomingEvent{
+			{Name: "Bounty Runes", GameTime: 180, In: 30},
+			{Name: "Power Rune", GameTime: 360, In: 210},
+			{Name: "Wisdom Runes", GameTime: 420, In: 270},
+			{Name: "Lotuses", GameTime: 600, In: 450},
+		},
+		Message: "Scheduler rolled forward by 10 seconds. GameTime: 00:02:30",
+	}
+	view.Fire(model.Notification{Kind: model.NotificationTimelineEvent, Event: "Water Runes", GameTime: 120})
+	view.Fire(model.Notification{Kind: model.NotificationTimelineEvent, Event: "Lotuses", GameTime: 0})
+
+	testCases := map[string]struct {
+		width         int
+		height        int
+		requiredLines []string
+	}{
+		"wide": {80, 24, []string{
+			"DotkaFX  RUNNING  Profile: test",
+			"",
+			"  ### ###     ### ###",
+			"  # #   #  #    # # #",
+			"  # # ###     ### # #",
+			"  # # #    #    # # #",
+			"  ### ###     ### ###",
+			"",
+			"Upcoming events:",
+			"   03:00  Bounty Runes         in 30s      [###########################...]",
+			"   06:00  Power Rune           in 3m30s    [#########.....................]",
+			"   07:00  Wisdom Runes         in 4m30s    [###...........................]",
+			"   10:00  Lotuses              in 7m30s    [..............................]",
+			"Last events:",
+			"   00:00  Lotuses",
+			"   02:00  Water Runes",
+			"",
+			"Scheduler rolled forward by 10 seconds. GameTime: 00:02:30",
+			"[s] start  [p] pause  [b/f] back/forward 10s  [</>] 1s  [q] quit",
+		}},
+		"narrow": {30, 12, []string{
+			"DotkaFX  RUNNING  Profile: tes",
+			"",
+			"Game time: 02:30",
+			"",
+			"Upcoming events:",
+			"   03:00  Bounty Runes        ",
+			"   06:00  Power Rune          ",
+			"Last events:",
+			"   00:00  Lotuses",
+			"",
+			"Scheduler rolled forward by 10",
+			"[s] start  [p] pause  [b/f] ba",
+		}},
+		"tiny": {20, 5, []string{
+			"DotkaFX  RUNNING  Pr",
+			"",
+			"Game time: 02:30",
+			"",
+			"Upcoming events:",
+		}},
+	}
+
+	for testCaseName, testCase := range testCases {
+		t.Logf("Testing render, with %s", testCaseName)
+
+		lines := view.Render(testCase.width, testCase.height)
+		require.Equal(testCase.requiredLines, lines, testCaseName)
+		for _, line := range lines {
+			require.LessOrEqual(utf8.RuneCountInString(line), testCase.width, testCaseName)
+		}
+		require.LessOrEqual(len(lines), testCase.height, testCaseName)
+	}
+}
+
+func TestRenderNegativeClock(t *testing.T) {
+	require := assert.New(t)
+
+	lines := tui.View{State: "stopped", GameTime: -60}.Render(80, 24)
+	require.Equal([]string{
+		"DotkaFX  STOPPED",
+		"",
+		"      ###   #     ### ###",
+		"      # #   #  #  # # # #",
+		"  ### # #   #     # # # #",
+		"      # #   #  #  # # # #",
+		"      ###   #     ### ###",
+		"",
+		"Upcoming events:",
+		"Last events:",
+		"",
+		"",
+		"[s] start  [p] pause  [b/f] back/forward 10s  [</>] 1s  [q] quit",
+	}, lines)
+}